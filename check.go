@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+	"github.com/AlexZzz/virtstat/output"
+	"github.com/urfave/cli"
+)
+
+// parseThresholds parses thresholds of flag values,
+// a value may hold several joined with commas.
+func parseThresholds(values []string) ([]output.Threshold, error) {
+	var ts []output.Threshold
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			t, err := output.ParseThreshold(s)
+			if err != nil {
+				return nil, err
+			}
+			ts = append(ts, t)
+		}
+	}
+	return ts, nil
+}
+
+/* checkDisks samples disks of the domain over count intervals and
+ * returns their records. Rates are computed over the whole time
+ * between the first and the last sample.
+ */
+func checkDisks(domainname string) ([]output.Record, error) {
+	backend, err := openBackend(connectURIs[0], false)
+	if err != nil {
+		return nil, err
+	}
+	defer backend.Close()
+	doms, err := collector.MatchDomains(backend, []string{domainname})
+	if err != nil {
+		return nil, err
+	}
+	if len(doms) > 1 {
+		return nil, fmt.Errorf("%s: matches %d domains, check takes one", domainname, len(doms))
+	}
+	cols, err := collector.NewAll(backend, doms, serial)
+	if err != nil {
+		return nil, err
+	}
+	first, err := collector.SampleAll(cols)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(time.Duration(count) * interval)
+	last, err := collector.SampleAll(cols)
+	if err != nil {
+		return nil, err
+	}
+	deltas := collector.Diff(first, last)
+	if extended {
+		return output.ExtendedDiskRecords(deltas), nil
+	}
+	return output.DiskRecords(deltas), nil
+}
+
+/* check returns state of disks of the domain named by the argument,
+ * plugin output text and records of the disks. Any failure, a domain
+ * or a disk missing included, is UNKNOWN.
+ */
+func check(c *cli.Context, warn, crit []output.Threshold) (int, string, []output.Record) {
+	if c.NArg() != 1 {
+		return output.StateUnknown, "a single domain is required", nil
+	}
+	if count <= 0 || interval <= 0 {
+		return output.StateUnknown, "--count and --interval must be positive", nil
+	}
+	if err := setConnectURIs(c); err != nil {
+		return output.StateUnknown, err.Error(), nil
+	}
+	if len(connectURIs) > 1 {
+		return output.StateUnknown, "a single host is required", nil
+	}
+	domainname := c.Args().First()
+	records, err := checkDisks(domainname)
+	if err != nil {
+		return output.StateUnknown, err.Error(), nil
+	}
+	state, problems, err := output.Check(records, warn, crit)
+	if err != nil {
+		return output.StateUnknown, err.Error(), records
+	}
+	if len(problems) > 0 {
+		return state, domainname + ": " + strings.Join(problems, ", "), records
+	}
+	return state, fmt.Sprintf("%s: %d disks", domainname, len(records)), records
+}
+
+// checkUsageError reports a bad command line as UNKNOWN, a plugin
+// exits with 3 then rather than 1 meaning WARNING.
+func checkUsageError(c *cli.Context, err error, isSubcommand bool) error {
+	output.WritePlugin(os.Stdout, "disk", output.StateUnknown, err.Error(), nil, nil, nil)
+	return cli.NewExitError("", output.StateUnknown)
+}
+
+// runCheck prints monitoring plugin output and exits with its state.
+func runCheck(c *cli.Context) error {
+	var crit []output.Threshold
+	warn, err := parseThresholds(c.StringSlice("warn"))
+	if err == nil {
+		crit, err = parseThresholds(c.StringSlice("crit"))
+	}
+	state, text, records := output.StateUnknown, "", []output.Record(nil)
+	if err != nil {
+		text = err.Error()
+	} else {
+		state, text, records = check(c, warn, crit)
+	}
+	output.WritePlugin(os.Stdout, "disk", state, text, records, warn, crit)
+	if state == output.StateOK {
+		return nil
+	}
+	return cli.NewExitError("", state)
+}
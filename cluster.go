@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+	"github.com/AlexZzz/virtstat/output"
+)
+
+// report holds records of one host sampled at t.
+type report struct {
+	host    string
+	t       time.Time
+	records []output.Record
+}
+
+// loadHosts reads connection URIs from a file, one per line.
+// Bare host names are connected to over ssh.
+func loadHosts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var uris []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "://") {
+			line = "qemu+ssh://" + line + "/system"
+		}
+		uris = append(uris, line)
+	}
+	return uris, s.Err()
+}
+
+// hostName returns host part of uri, uri itself for local connections.
+func hostName(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return uri
+	}
+	return u.Hostname()
+}
+
+// openStatsBackend connects to libvirt at uri with events,
+// tests replace it.
+var openStatsBackend = func(uri string) (collector.Backend, error) {
+	b, err := openBackend(uri, true)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+/* watchHost samples domains of the host at uri every interval
+ * and sends reports until count reports are sent in total,
+ * sent counts reports across reconnects. Records are tagged
+ * with host.
+ */
+func watchHost(uri, host string, newSampler samplerFunc, sent *int, reports chan<- report) error {
+	backend, err := openStatsBackend(uri)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+	doms, err := collector.MatchDomains(backend, domainnames)
+	if err != nil {
+		return err
+	}
+	smp, err := newSampler(backend, doms)
+	if err != nil {
+		return err
+	}
+
+	/* Ticker keeps the pace regardless of time spent
+	 * in libvirt calls, rates are computed over
+	 * the measured time anyway.
+	 */
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for c := 0; count == 0 || *sent < count; c++ {
+		if c > 0 {
+			<-ticker.C
+		}
+		t := time.Now()
+		records, err := smp.sample()
+		if err != nil {
+			return err
+		}
+		for i := range records {
+			records[i].Host = host
+		}
+		reports <- report{host: host, t: t, records: records}
+		*sent++
+	}
+	return nil
+}
+
+/* retryHost logs err of a host and waits an interval to reconnect.
+ * The failed interval counts as sent, it reports whether any are
+ * left, so a host never coming back ends along with the others.
+ */
+func retryHost(host string, err error, sent *int) bool {
+	*sent++
+	if count > 0 && *sent >= count {
+		return false
+	}
+	log.Printf("%s: %v, reconnecting in %v", host, err, interval)
+	time.Sleep(interval)
+	return true
+}
+
+/* watchAll runs a goroutine per connection URI sending reports
+ * until every host is done. A single host is not tagged and fails
+ * if the first connection does. Several hosts are tagged with host
+ * names. A host failing later, say libvirtd restarts, is reconnected
+ * to every interval, so neither a failed nor a slow one delays
+ * reports of the others.
+ */
+func watchAll(newSampler samplerFunc, reports chan<- report) <-chan error {
+	errc := make(chan error, 1)
+	if len(connectURIs) == 1 {
+		go func() {
+			var sent int
+			uri := connectURIs[0]
+			for {
+				err := watchHost(uri, "", newSampler, &sent, reports)
+				if err == nil || sent == 0 {
+					errc <- err
+					break
+				}
+				if !retryHost(uri, err, &sent) {
+					errc <- err
+					break
+				}
+			}
+			close(reports)
+		}()
+		return errc
+	}
+	var wg sync.WaitGroup
+	for _, uri := range connectURIs {
+		wg.Add(1)
+		go func(uri string) {
+			defer wg.Done()
+			host := hostName(uri)
+			var sent int
+			for {
+				err := watchHost(uri, host, newSampler, &sent, reports)
+				if err == nil {
+					return
+				}
+				if collector.IsNotFound(err) {
+					log.Printf("%s: %v", host, err)
+					return
+				}
+				if !retryHost(host, err, &sent) {
+					log.Printf("%s: %v", host, err)
+					return
+				}
+			}
+		}(uri)
+	}
+	go func() {
+		wg.Wait()
+		errc <- nil
+		close(reports)
+	}()
+	return errc
+}
+
+// printReports writes every report as it comes.
+func printReports(reports <-chan report, out output.Formatter) error {
+	for r := range reports {
+		if err := out.Write(r.t, r.records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* printTop writes topN records ranked by sum of topBy fields
+ * out of the latest reports of every host once an interval.
+ * Reports older than two intervals are left out, so a stalled
+ * host drops out of the summary.
+ */
+func printTop(reports <-chan report, out output.Formatter) error {
+	latest := make(map[string]report)
+	var hosts []string
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	by := strings.Split(topBy, "+")
+	write := func() error {
+		now := time.Now()
+		var records []output.Record
+		for _, h := range hosts {
+			if r := latest[h]; now.Sub(r.t) < 2*interval {
+				records = append(records, r.records...)
+			}
+		}
+		return out.Write(now, output.Top(records, by, topN))
+	}
+	for {
+		select {
+		case r, ok := <-reports:
+			if !ok {
+				return write()
+			}
+			if _, seen := latest[r.host]; !seen {
+				hosts = append(hosts, r.host)
+			}
+			latest[r.host] = r
+		case <-ticker.C:
+			if err := write(); err != nil {
+				return err
+			}
+		}
+	}
+}
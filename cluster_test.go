@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+	"github.com/AlexZzz/virtstat/output"
+)
+
+// countSampler samples a record per call.
+type countSampler struct{}
+
+func (countSampler) sample() ([]output.Record, error) {
+	return []output.Record{{Domain: "web"}}, nil
+}
+
+func newCountSampler(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	return countSampler{}, nil
+}
+
+// TestWatchAllUnreachable checks a host never connected to does not
+// keep the others from ending once count reports are sent.
+func TestWatchAllUnreachable(t *testing.T) {
+	defer func(uris []string, c int, i time.Duration, open func(string) (collector.Backend, error)) {
+		connectURIs, count, interval, openStatsBackend = uris, c, i, open
+	}(connectURIs, count, interval, openStatsBackend)
+	connectURIs = []string{"qemu+ssh://up/system", "qemu+ssh://down/system"}
+	count = 3
+	interval = time.Millisecond
+	openStatsBackend = func(uri string) (collector.Backend, error) {
+		if uri != connectURIs[0] {
+			return nil, errors.New("connection refused")
+		}
+		b := collector.NewScriptedBackend()
+		b.AddDomain("web", "u-1", "<domain/>")
+		return b, nil
+	}
+
+	reports := make(chan report)
+	errc := watchAll(newCountSampler, reports)
+	byHost := make(map[string]int)
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case r, ok := <-reports:
+			if !ok {
+				done = true
+				break
+			}
+			byHost[r.host]++
+		case <-timeout:
+			t.Fatal("watchAll never ends")
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if byHost["up"] != count || byHost["down"] != 0 {
+		t.Errorf("got reports %v, want %d of up only", byHost, count)
+	}
+}
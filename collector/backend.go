@@ -0,0 +1,88 @@
+package collector
+
+// Domain identifies a libvirt domain.
+type Domain struct {
+	Name string
+	UUID string
+}
+
+// Backend is a source of domains statistics.
+// Domains are referred to by uuid.
+type Backend interface {
+	// ListDomains returns active domains.
+	ListDomains() ([]Domain, error)
+	// ListAllDomains returns active and inactive domains.
+	ListAllDomains() ([]Domain, error)
+	// DomainInfo returns state, vcpus and memory of a domain.
+	DomainInfo(uuid string) (DomainInfo, error)
+	// DomainXML returns XML description of a domain.
+	DomainXML(uuid string) (string, error)
+	// BlockStats returns counters of a disk, disk is a target device name.
+	BlockStats(uuid, disk string) (BlockStats, error)
+	// BlockInfo returns sizes of a disk.
+	BlockInfo(uuid, disk string) (BlockInfo, error)
+	// BlockIoTune returns I/O limits of a disk.
+	BlockIoTune(uuid, disk string) (IoTune, error)
+	// InterfaceStats returns counters of a network interface,
+	// iface is a target device name.
+	InterfaceStats(uuid, iface string) (InterfaceStats, error)
+	// CPUStats returns total cpu time counters of a domain.
+	CPUStats(uuid string) (CPUStats, error)
+	// VcpuStats returns statistics of every vcpu of a domain.
+	VcpuStats(uuid string) ([]VcpuStats, error)
+	// MemoryStats returns memory statistics of a domain.
+	MemoryStats(uuid string) (MemoryStats, error)
+	// SetMemoryStatsPeriod sets balloon driver statistics polling
+	// period of a running domain, seconds.
+	SetMemoryStatsPeriod(uuid string, period int) error
+	// Close releases resources held by the backend.
+	Close() error
+}
+
+// DomainStats holds statistics of a single domain returned by a bulk call.
+// Block, BlockInfo and Interface are keyed by target device name.
+type DomainStats struct {
+	UUID      string
+	Block     map[string]BlockStats
+	BlockInfo map[string]BlockInfo
+	Interface map[string]InterfaceStats
+}
+
+// StatsGroup selects statistics returned by a bulk call,
+// groups not selected are left empty.
+type StatsGroup int
+
+const (
+	// StatsBlock selects Block and BlockInfo.
+	StatsBlock StatsGroup = 1 << iota
+	// StatsInterface selects Interface.
+	StatsInterface
+)
+
+// BulkBackend is a Backend able to return statistics of many domains
+// in one call, which is much cheaper than a call per device on hosts
+// running lots of domains.
+type BulkBackend interface {
+	Backend
+	// AllDomainStats returns statistics groups of domains with given uuids.
+	AllDomainStats(uuids []string, groups StatsGroup) ([]DomainStats, error)
+}
+
+// BackingBackend is a BulkBackend able to report statistics of every
+// backing chain layer of disks. Layers below the top one are keyed
+// by names like "vda[1]", see Disk.Layers.
+type BackingBackend interface {
+	BulkBackend
+	// AllDomainStatsBacking returns block statistics of domains with
+	// given uuids including backing chain layers.
+	AllDomainStatsBacking(uuids []string) ([]DomainStats, error)
+}
+
+// EventBackend is a Backend notifying of domain events.
+type EventBackend interface {
+	Backend
+	// Subscribe calls handle for every event of every domain
+	// until the backend is closed. handle is called from
+	// another goroutine and must not block.
+	Subscribe(handle func(Event)) error
+}
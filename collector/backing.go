@@ -0,0 +1,227 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Layer is an image of a disk backing chain. The top layer, Depth 0,
+// is named after the disk target, backing images are named like
+// libvirt does, "vda[1]", using their index.
+type Layer struct {
+	Disk   Disk
+	Name   string
+	Depth  int
+	Path   string
+	Format string
+}
+
+// Layers returns the backing chain of d from the top image down
+// to the base one.
+func (d Disk) Layers() []Layer {
+	layers := []Layer{{
+		Disk:   d,
+		Name:   d.Target.DiskName,
+		Path:   d.Source.Path(),
+		Format: d.Driver.Type,
+	}}
+	/* Chain ends with an empty <backingStore/>
+	 * or with no element at all
+	 */
+	for bs := d.BackingStore; bs != nil && bs.Type != ""; bs = bs.BackingStore {
+		depth := len(layers)
+		index := bs.Index
+		if index == 0 {
+			index = depth
+		}
+		layers = append(layers, Layer{
+			Disk:   d,
+			Name:   fmt.Sprintf("%s[%d]", d.Target.DiskName, index),
+			Depth:  depth,
+			Path:   bs.Source.Path(),
+			Format: bs.Format.Type,
+		})
+	}
+	return layers
+}
+
+// Path returns file or device path of the source, pool/volume
+// for storage pool volumes and URL-like protocol://host/name
+// for network disks.
+func (s DiskSource) Path() string {
+	switch {
+	case s.File != "":
+		return s.File
+	case s.Dev != "":
+		return s.Dev
+	case s.Volume != "":
+		return s.Pool + "/" + s.Volume
+	case s.Protocol != "":
+		var hosts []string
+		for _, h := range s.Hosts {
+			if h.Port != "" {
+				hosts = append(hosts, h.Name+":"+h.Port)
+			} else {
+				hosts = append(hosts, h.Name)
+			}
+		}
+		return s.Protocol + "://" + strings.Join(hosts, ",") + "/" + s.Name
+	}
+	return ""
+}
+
+// LayerSample is a snapshot of one backing chain layer counters
+// and sizes taken at Time.
+type LayerSample struct {
+	Domain string
+	UUID   string
+	Layer  Layer
+	Time   time.Time
+	Stats  BlockStats
+	Info   BlockInfo
+}
+
+// LayerDelta holds counters difference between two samples of a layer
+// in Stats, its current counters in Total, its current sizes in Info
+// and allocation change in Growth.
+type LayerDelta struct {
+	Domain   string
+	UUID     string
+	Layer    Layer
+	Time     time.Time
+	Interval time.Duration
+	Stats    BlockStats
+	Total    BlockStats
+	Info     BlockInfo
+	Growth   int64
+	Reset    bool
+}
+
+// SampleLayers reads counters and sizes of every layer of collected
+// disks one by one.
+func (c *Collector) SampleLayers() ([]LayerSample, error) {
+	var samples []LayerSample
+	for _, v := range c.disks {
+		for _, l := range v.Layers() {
+			dbs, err := c.backend.BlockStats(c.dom.UUID, l.Name)
+			if err != nil {
+				return nil, err
+			}
+			bi, err := c.backend.BlockInfo(c.dom.UUID, l.Name)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, LayerSample{
+				Domain: c.dom.Name,
+				UUID:   c.dom.UUID,
+				Layer:  l,
+				Time:   now(),
+				Stats:  dbs,
+				Info:   bi,
+			})
+		}
+	}
+	return samples, nil
+}
+
+// SampleAllLayers samples every backing chain layer of collected disks.
+// Collectors sharing a backend which implements BackingBackend
+// are sampled with a single call.
+func SampleAllLayers(cols []*Collector) ([]LayerSample, error) {
+	var samples []LayerSample
+	var single []*Collector
+	byBackend := make(map[BackingBackend][]*Collector)
+	var backends []BackingBackend
+	for _, c := range cols {
+		bb, ok := c.backend.(BackingBackend)
+		if !ok {
+			single = append(single, c)
+			continue
+		}
+		if _, ok := byBackend[bb]; !ok {
+			backends = append(backends, bb)
+		}
+		byBackend[bb] = append(byBackend[bb], c)
+	}
+	for _, c := range single {
+		s, err := c.SampleLayers()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s...)
+	}
+	for _, bb := range backends {
+		var uuids []string
+		for _, c := range byBackend[bb] {
+			uuids = append(uuids, c.dom.UUID)
+		}
+		stats, err := bb.AllDomainStatsBacking(uuids)
+		t := now()
+		if err != nil {
+			return nil, err
+		}
+		byUUID := make(map[string]*DomainStats, len(stats))
+		for i := range stats {
+			byUUID[stats[i].UUID] = &stats[i]
+		}
+		for _, c := range byBackend[bb] {
+			ds, ok := byUUID[c.dom.UUID]
+			if !ok {
+				return nil, errNoSuchDomain(c.dom.Name)
+			}
+			for _, v := range c.disks {
+				for _, l := range v.Layers() {
+					dbs, ok := ds.Block[l.Name]
+					if !ok {
+						return nil, errNoSuchDisk(l.Name)
+					}
+					samples = append(samples, LayerSample{
+						Domain: c.dom.Name,
+						UUID:   c.dom.UUID,
+						Layer:  l,
+						Time:   t,
+						Stats:  dbs,
+						Info:   ds.BlockInfo[l.Name],
+					})
+				}
+			}
+		}
+	}
+	return samples, nil
+}
+
+// DiffLayers matches current samples with previous ones by domain
+// and layer name. Layers without a previous sample get zero counters,
+// deltas of counters which went backwards are marked Reset.
+func DiffLayers(prev, cur []LayerSample) []LayerDelta {
+	type key struct {
+		uuid, layer string
+	}
+	byKey := make(map[key]*LayerSample, len(prev))
+	for i := range prev {
+		byKey[key{prev[i].UUID, prev[i].Layer.Name}] = &prev[i]
+	}
+	deltas := make([]LayerDelta, 0, len(cur))
+	for _, c := range cur {
+		d := LayerDelta{
+			Domain: c.Domain,
+			UUID:   c.UUID,
+			Layer:  c.Layer,
+			Time:   c.Time,
+			Total:  c.Stats,
+			Info:   c.Info,
+		}
+		if p, ok := byKey[key{c.UUID, c.Layer.Name}]; ok {
+			if s := c.Stats.Sub(p.Stats); s.negative() {
+				d.Reset = true
+			} else {
+				d.Interval = c.Time.Sub(p.Time)
+				d.Stats = s
+				d.Growth = c.Info.Allocation - p.Info.Allocation
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
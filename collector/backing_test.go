@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+const backingDomainXML = `<domain><devices>
+<disk type="file" device="disk">
+  <driver name="qemu" type="qcow2"/>
+  <source file="/var/lib/libvirt/images/vm.qcow2" index="3"/>
+  <backingStore type="file" index="2">
+    <format type="qcow2"/>
+    <source file="/var/lib/libvirt/images/snap.qcow2"/>
+    <backingStore type="block" index="1">
+      <format type="raw"/>
+      <source dev="/dev/base/ubuntu"/>
+      <backingStore/>
+    </backingStore>
+  </backingStore>
+  <target dev="vda" bus="virtio"/>
+</disk>
+</devices></domain>`
+
+func TestLayers(t *testing.T) {
+	desc, err := ParseDomainXML(backingDomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers := desc.Devices.Disks[0].Layers()
+	want := []Layer{
+		{Name: "vda", Depth: 0, Path: "/var/lib/libvirt/images/vm.qcow2", Format: "qcow2"},
+		{Name: "vda[2]", Depth: 1, Path: "/var/lib/libvirt/images/snap.qcow2", Format: "qcow2"},
+		{Name: "vda[1]", Depth: 2, Path: "/dev/base/ubuntu", Format: "raw"},
+	}
+	if len(layers) != len(want) {
+		t.Fatalf("got %d layers, want %d", len(layers), len(want))
+	}
+	for i, l := range layers {
+		w := want[i]
+		if l.Name != w.Name || l.Depth != w.Depth || l.Path != w.Path || l.Format != w.Format {
+			t.Errorf("layer %d = %+v, want %+v", i, l, want[i])
+		}
+	}
+}
+
+func TestSampleAllLayers(t *testing.T) {
+	clock, restore := setClock()
+	defer restore()
+	b := NewScriptedBackend()
+	b.AddDomain("vm", "u-1", backingDomainXML)
+	b.AddBlockStats("u-1", "vda", BlockStats{}, BlockStats{RdReq: 10})
+	b.AddBlockStats("u-1", "vda[2]", BlockStats{})
+	b.AddBlockStats("u-1", "vda[1]", BlockStats{}, BlockStats{RdReq: 8, RdBytes: 8 * 1024})
+	col, err := New(b, Domain{Name: "vm", UUID: "u-1"}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, err := SampleAllLayers([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(2 * time.Second)
+	cur, err := SampleAllLayers([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltas := DiffLayers(prev, cur)
+	if len(deltas) != 3 {
+		t.Fatalf("got %d deltas, want 3", len(deltas))
+	}
+	base := deltas[2].Rates()
+	if deltas[2].Layer.Name != "vda[1]" || !almostEqual(base.RdReq, 4) || !almostEqual(base.RdKB, 4) {
+		t.Errorf("base layer %s: %+v", deltas[2].Layer.Name, base)
+	}
+}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"time"
+)
+
+// CapacitySample is a snapshot of one disk sizes taken at Time.
+type CapacitySample struct {
+	Domain string
+	UUID   string
+	Disk   Disk
+	Time   time.Time
+	Info   BlockInfo
+}
+
+// CapacityDelta holds current sizes of a disk in Info and
+// allocation change between two samples in Growth, bytes.
+type CapacityDelta struct {
+	Domain   string
+	UUID     string
+	Disk     Disk
+	Time     time.Time
+	Interval time.Duration
+	Info     BlockInfo
+	Growth   int64
+}
+
+// SampleCapacity reads current sizes of every collected disk.
+func (c *Collector) SampleCapacity() ([]CapacitySample, error) {
+	var samples []CapacitySample
+	for _, v := range c.disks {
+		bi, err := c.backend.BlockInfo(c.dom.UUID, v.Target.DiskName)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, CapacitySample{
+			Domain: c.dom.Name,
+			UUID:   c.dom.UUID,
+			Disk:   v,
+			Time:   now(),
+			Info:   bi,
+		})
+	}
+	return samples, nil
+}
+
+// SampleAllCapacity samples disks sizes of every collector, in bulk
+// where possible. Disks the bulk call reports no sizes for are
+// queried one by one.
+func SampleAllCapacity(cols []*Collector) ([]CapacitySample, error) {
+	var samples []CapacitySample
+	single, groups := groupBulk(cols)
+	for _, c := range single {
+		s, err := c.SampleCapacity()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s...)
+	}
+	for _, g := range groups {
+		byUUID, t, err := g.fetch(StatsBlock)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range g.cols {
+			ds, ok := byUUID[c.dom.UUID]
+			if !ok {
+				return nil, errNoSuchDomain(c.dom.Name)
+			}
+			for _, v := range c.disks {
+				s := CapacitySample{
+					Domain: c.dom.Name,
+					UUID:   c.dom.UUID,
+					Disk:   v,
+					Time:   t,
+				}
+				bi, ok := ds.BlockInfo[v.Target.DiskName]
+				if !ok {
+					bi, err = c.backend.BlockInfo(c.dom.UUID, v.Target.DiskName)
+					if err != nil {
+						return nil, err
+					}
+					s.Time = now()
+				}
+				s.Info = bi
+				samples = append(samples, s)
+			}
+		}
+	}
+	return samples, nil
+}
+
+// DiffCapacity matches current samples with previous ones by domain
+// and disk. Disks without a previous sample get zero growth.
+func DiffCapacity(prev, cur []CapacitySample) []CapacityDelta {
+	type key struct {
+		uuid, disk string
+	}
+	byKey := make(map[key]*CapacitySample, len(prev))
+	for i := range prev {
+		byKey[key{prev[i].UUID, prev[i].Disk.Target.DiskName}] = &prev[i]
+	}
+	deltas := make([]CapacityDelta, 0, len(cur))
+	for _, c := range cur {
+		d := CapacityDelta{
+			Domain: c.Domain,
+			UUID:   c.UUID,
+			Disk:   c.Disk,
+			Time:   c.Time,
+			Info:   c.Info,
+		}
+		if p, ok := byKey[key{c.UUID, c.Disk.Target.DiskName}]; ok {
+			d.Interval = c.Time.Sub(p.Time)
+			d.Growth = c.Info.Allocation - p.Info.Allocation
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
@@ -0,0 +1,232 @@
+// Package collector samples statistics of libvirt domains.
+package collector
+
+import (
+	"time"
+)
+
+// Collector samples devices statistics of a single domain.
+type Collector struct {
+	backend Backend
+	dom     Domain
+	disks   []Disk
+	ifaces  []Interface
+	// memPeriod is balloon statistics period, seconds
+	memPeriod int
+	// iotune holds disks limits by target name
+	iotune map[string]*IoTune
+}
+
+// LookupDomain finds an active domain by name or uuid.
+func LookupDomain(b Backend, domainname string) (Domain, error) {
+	doms, err := b.ListDomains()
+	if err != nil {
+		return Domain{}, err
+	}
+	for _, dom := range doms {
+		if dom.Name == domainname || dom.UUID == domainname {
+			return dom, nil
+		}
+	}
+	return Domain{}, errNoSuchDomain(domainname)
+}
+
+// newCollector creates a collector without devices and returns
+// parsed description of dom.
+func newCollector(b Backend, dom Domain) (*Collector, *DomainDesc, error) {
+	x, err := b.DomainXML(dom.UUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	desc, err := ParseDomainXML(x)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Collector{backend: b, dom: dom}, desc, nil
+}
+
+// Empty reports whether d is a removable drive without media,
+// libvirt has no statistics of it.
+func (d Disk) Empty() bool {
+	return (d.Device == "cdrom" || d.Device == "floppy") && d.Source.Path() == ""
+}
+
+// New creates a collector for disks of dom matching serial.
+// serial is a disk name or serial, "all" matches every disk.
+// Empty drives are skipped.
+func New(b Backend, dom Domain, serial string) (*Collector, error) {
+	c, desc, err := newCollector(b, dom)
+	if err != nil {
+		return nil, err
+	}
+	// Filter disks by name or serial
+	for _, v := range desc.Devices.Disks {
+		if serial != "all" && serial != v.Target.DiskName && serial != v.Serial {
+			continue
+		}
+		if v.Empty() {
+			continue
+		}
+		c.disks = append(c.disks, v)
+	}
+	if len(c.disks) == 0 {
+		return nil, errNoSuchDisk(serial)
+	}
+	return c, nil
+}
+
+// Disks returns disks being sampled.
+func (c *Collector) Disks() []Disk {
+	return c.disks
+}
+
+// LoadIoTune reads I/O limits of collected disks, they are attached
+// to every following sample. Limits are read once, as they rarely change.
+func (c *Collector) LoadIoTune() error {
+	c.iotune = make(map[string]*IoTune)
+	for _, v := range c.disks {
+		t, err := c.backend.BlockIoTune(c.dom.UUID, v.Target.DiskName)
+		if err != nil {
+			return err
+		}
+		c.iotune[v.Target.DiskName] = &t
+	}
+	return nil
+}
+
+// Sample reads current counters of every collected disk.
+func (c *Collector) Sample() ([]Sample, error) {
+	var samples []Sample
+	for _, v := range c.disks {
+		dbs, err := c.backend.BlockStats(c.dom.UUID, v.Target.DiskName)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, Sample{
+			Domain: c.dom.Name,
+			UUID:   c.dom.UUID,
+			Disk:   v,
+			Time:   now(),
+			Stats:  dbs,
+			IoTune: c.iotune[v.Target.DiskName],
+		})
+	}
+	return samples, nil
+}
+
+// newAll calls newf for every domain in doms skipping domains
+// without requested devices. notFound is returned if no domain has them.
+func newAll(doms []Domain, newf func(Domain) (*Collector, error), notFound error) ([]*Collector, error) {
+	var cols []*Collector
+	for _, dom := range doms {
+		c, err := newf(dom)
+		if err != nil {
+			if _, ok := err.(*errMessage); ok {
+				continue
+			}
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	if len(cols) == 0 {
+		return nil, notFound
+	}
+	return cols, nil
+}
+
+// NewAll creates collectors for disks matching serial of every domain
+// in doms. Domains without such disks are skipped.
+func NewAll(b Backend, doms []Domain, serial string) ([]*Collector, error) {
+	return newAll(doms, func(dom Domain) (*Collector, error) {
+		return New(b, dom, serial)
+	}, errNoSuchDisk(serial))
+}
+
+// bulkGroup is a set of collectors sharing a bulk capable backend.
+type bulkGroup struct {
+	backend BulkBackend
+	cols    []*Collector
+}
+
+// groupBulk splits cols into collectors which have to be sampled
+// one by one and groups of collectors sampled with a single call.
+func groupBulk(cols []*Collector) ([]*Collector, []*bulkGroup) {
+	var single []*Collector
+	var groups []*bulkGroup
+	byBackend := make(map[BulkBackend]*bulkGroup)
+	for _, c := range cols {
+		bb, ok := c.backend.(BulkBackend)
+		if !ok {
+			single = append(single, c)
+			continue
+		}
+		g, ok := byBackend[bb]
+		if !ok {
+			g = &bulkGroup{backend: bb}
+			byBackend[bb] = g
+			groups = append(groups, g)
+		}
+		g.cols = append(g.cols, c)
+	}
+	return single, groups
+}
+
+// fetch returns statistics groups of the group domains keyed by uuid
+// and the time they were received at.
+func (g *bulkGroup) fetch(groups StatsGroup) (map[string]*DomainStats, time.Time, error) {
+	var uuids []string
+	for _, c := range g.cols {
+		uuids = append(uuids, c.dom.UUID)
+	}
+	stats, err := g.backend.AllDomainStats(uuids, groups)
+	t := now()
+	if err != nil {
+		return nil, t, err
+	}
+	byUUID := make(map[string]*DomainStats, len(stats))
+	for i := range stats {
+		byUUID[stats[i].UUID] = &stats[i]
+	}
+	return byUUID, t, nil
+}
+
+// SampleAll samples disks of every collector. Collectors sharing
+// a backend which implements BulkBackend are sampled with a single call.
+func SampleAll(cols []*Collector) ([]Sample, error) {
+	var samples []Sample
+	single, groups := groupBulk(cols)
+	for _, c := range single {
+		s, err := c.Sample()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s...)
+	}
+	for _, g := range groups {
+		byUUID, t, err := g.fetch(StatsBlock)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range g.cols {
+			ds, ok := byUUID[c.dom.UUID]
+			if !ok {
+				return nil, errNoSuchDomain(c.dom.Name)
+			}
+			for _, v := range c.disks {
+				dbs, ok := ds.Block[v.Target.DiskName]
+				if !ok {
+					return nil, errNoSuchDisk(v.Target.DiskName)
+				}
+				samples = append(samples, Sample{
+					Domain: c.dom.Name,
+					UUID:   c.dom.UUID,
+					Disk:   v,
+					Time:   t,
+					Stats:  dbs,
+					IoTune: c.iotune[v.Target.DiskName],
+				})
+			}
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+)
+
+const benchDomainXML = `<domain><devices>
+<disk><target dev="vda" bus="virtio"/></disk>
+<disk><target dev="vdb" bus="virtio"/></disk>
+<disk><target dev="vdc" bus="virtio"/></disk>
+<disk><target dev="vdd" bus="virtio"/></disk>
+</devices></domain>`
+
+// countingBackend counts stats calls, each of them is a round trip
+// to libvirtd in a real backend.
+type countingBackend struct {
+	*ScriptedBackend
+	calls int
+}
+
+func (b *countingBackend) BlockStats(uuid, disk string) (BlockStats, error) {
+	b.calls++
+	return b.ScriptedBackend.BlockStats(uuid, disk)
+}
+
+func (b *countingBackend) AllDomainStats(uuids []string, groups StatsGroup) ([]DomainStats, error) {
+	b.calls++
+	return b.ScriptedBackend.AllDomainStats(uuids, groups)
+}
+
+// perDomainBackend hides AllDomainStats of the wrapped backend.
+type perDomainBackend struct {
+	Backend
+}
+
+func newBenchBackend(domains int) *countingBackend {
+	b := NewScriptedBackend()
+	for i := 0; i < domains; i++ {
+		uuid := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+		b.AddDomain(fmt.Sprintf("instance-%08x", i), uuid, benchDomainXML)
+		for _, disk := range []string{"vda", "vdb", "vdc", "vdd"} {
+			b.AddBlockStats(uuid, disk,
+				BlockStats{RdReq: 1, WrReq: 1},
+				BlockStats{RdReq: 2, WrReq: 2})
+		}
+	}
+	return &countingBackend{ScriptedBackend: b}
+}
+
+func TestAllDomainStatsGroups(t *testing.T) {
+	b := NewScriptedBackend()
+	uuid := "00000000-0000-0000-0000-000000000000"
+	b.AddDomain("web", uuid, benchDomainXML)
+	b.AddBlockStats(uuid, "vda", BlockStats{RdReq: 1}, BlockStats{RdReq: 2})
+	b.AddInterfaceStats(uuid, "vnet0", InterfaceStats{RxBytes: 1}, InterfaceStats{RxBytes: 2})
+
+	// Sampling interfaces leaves the block sequence where it was
+	for i := int64(1); i <= 2; i++ {
+		stats, err := b.AllDomainStats([]string{uuid}, StatsInterface)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats[0].Block) != 0 || stats[0].Interface["vnet0"].RxBytes != i {
+			t.Errorf("interfaces %d: got %+v", i, stats[0])
+		}
+	}
+	stats, err := b.AllDomainStats([]string{uuid}, StatsBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats[0].Interface) != 0 || stats[0].Block["vda"].RdReq != 1 {
+		t.Errorf("block: got %+v", stats[0])
+	}
+}
+
+func TestSampleAllEmptyDrive(t *testing.T) {
+	b := NewScriptedBackend()
+	uuid := "00000000-0000-0000-0000-000000000000"
+	b.AddDomain("web", uuid, `<domain><devices>
+<disk device="disk"><source file="/var/lib/web.qcow2"/><target dev="vda" bus="virtio"/></disk>
+<disk device="cdrom"><target dev="sda" bus="sata"/></disk>
+</devices></domain>`)
+	b.AddBlockStats(uuid, "vda", BlockStats{RdReq: 1})
+	cols, err := NewAll(b, []Domain{{Name: "web", UUID: uuid}}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := SampleAll(cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Disk.Target.DiskName != "vda" {
+		t.Errorf("got %d samples, want vda only", len(samples))
+	}
+}
+
+// benchmarkInterval measures one interval: sampling every disk of
+// every domain and computing deltas.
+func benchmarkInterval(b *testing.B, backend Backend, counter *countingBackend) {
+	doms, err := MatchDomains(backend, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cols, err := NewAll(backend, doms, "all")
+	if err != nil {
+		b.Fatal(err)
+	}
+	prev, err := SampleAll(cols)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	counter.calls = 0
+	for i := 0; i < b.N; i++ {
+		cur, err := SampleAll(cols)
+		if err != nil {
+			b.Fatal(err)
+		}
+		Diff(prev, cur)
+		prev = cur
+	}
+	b.ReportMetric(float64(counter.calls)/float64(b.N), "calls/op")
+}
+
+func BenchmarkIntervalBulk1000(b *testing.B) {
+	backend := newBenchBackend(1000)
+	benchmarkInterval(b, backend, backend)
+}
+
+func BenchmarkIntervalPerDomain1000(b *testing.B) {
+	backend := newBenchBackend(1000)
+	benchmarkInterval(b, perDomainBackend{backend}, backend)
+}
@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"time"
+)
+
+// CPUSample is a snapshot of domain and its vcpus cpu time
+// taken at Time.
+type CPUSample struct {
+	Domain string
+	UUID   string
+	Time   time.Time
+	Stats  CPUStats
+	Vcpus  []VcpuStats
+}
+
+// CPUDelta is a cpu time difference between two samples of the same
+// domain, Total holds cpu time of the current one. Vcpus hold time
+// differences along with the current state and physical cpu.
+type CPUDelta struct {
+	Domain   string
+	UUID     string
+	Time     time.Time
+	Interval time.Duration
+	Stats    CPUStats
+	Total    CPUStats
+	Vcpus    []VcpuStats
+	// Reset is set if counters were reset since the previous sample
+	Reset bool
+}
+
+// Sub returns counters difference s - o.
+func (s CPUStats) Sub(o CPUStats) CPUStats {
+	return CPUStats{
+		CPUTime:    s.CPUTime - o.CPUTime,
+		UserTime:   s.UserTime - o.UserTime,
+		SystemTime: s.SystemTime - o.SystemTime,
+	}
+}
+
+// Sub returns time difference of v and o keeping state of v.
+func (v VcpuStats) Sub(o VcpuStats) VcpuStats {
+	v.Time -= o.Time
+	return v
+}
+
+// NewCPU creates a collector for cpu statistics of dom.
+func NewCPU(b Backend, dom Domain) (*Collector, error) {
+	return &Collector{backend: b, dom: dom}, nil
+}
+
+// NewAllCPU creates collectors for cpu statistics of every domain in doms.
+func NewAllCPU(b Backend, doms []Domain) ([]*Collector, error) {
+	if len(doms) == 0 {
+		return nil, errNoDomains()
+	}
+	var cols []*Collector
+	for _, dom := range doms {
+		c, err := NewCPU(b, dom)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// SampleCPU reads current cpu time of the domain and its vcpus.
+func (c *Collector) SampleCPU() (CPUSample, error) {
+	cs, err := c.backend.CPUStats(c.dom.UUID)
+	t := now()
+	if err != nil {
+		return CPUSample{}, err
+	}
+	vcpus, err := c.backend.VcpuStats(c.dom.UUID)
+	if err != nil {
+		return CPUSample{}, err
+	}
+	return CPUSample{
+		Domain: c.dom.Name,
+		UUID:   c.dom.UUID,
+		Time:   t,
+		Stats:  cs,
+		Vcpus:  vcpus,
+	}, nil
+}
+
+// SampleAllCPU samples cpu statistics of every collector.
+// Physical cpu of vcpus is only reported per domain,
+// so there is no bulk path.
+func SampleAllCPU(cols []*Collector) ([]CPUSample, error) {
+	var samples []CPUSample
+	for _, c := range cols {
+		s, err := c.SampleCPU()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// DiffCPU matches current samples with previous ones by domain and
+// returns cpu time differences. Domains and vcpus without a previous
+// sample get zero delta, deltas of counters which went backwards
+// are marked Reset.
+func DiffCPU(prev, cur []CPUSample) []CPUDelta {
+	byUUID := make(map[string]*CPUSample, len(prev))
+	for i := range prev {
+		byUUID[prev[i].UUID] = &prev[i]
+	}
+	deltas := make([]CPUDelta, 0, len(cur))
+	for _, c := range cur {
+		d := CPUDelta{
+			Domain: c.Domain,
+			UUID:   c.UUID,
+			Time:   c.Time,
+			Total:  c.Stats,
+		}
+		p, ok := byUUID[c.UUID]
+		if ok {
+			d.Interval = c.Time.Sub(p.Time)
+			d.Stats = c.Stats.Sub(p.Stats)
+			d.Reset = d.Stats.negative()
+		}
+		for _, v := range c.Vcpus {
+			dv := v
+			dv.Time = 0
+			if ok {
+				for _, pv := range p.Vcpus {
+					if pv.Number == v.Number {
+						dv = v.Sub(pv)
+						break
+					}
+				}
+			}
+			if dv.Time < 0 {
+				d.Reset = true
+			}
+			d.Vcpus = append(d.Vcpus, dv)
+		}
+		if d.Reset {
+			d.Interval = 0
+			d.Stats = CPUStats{}
+			for i := range d.Vcpus {
+				d.Vcpus[i].Time = 0
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"encoding/xml"
+)
+
+/* Structs to be filled from xml
+ * description of domain
+ * XML desc: https://libvirt.org/formatdomain.html
+ */
+type Disk struct {
+	XMLName xml.Name `xml:"disk"`
+	Type    string   `xml:"type,attr"`
+	Device  string   `xml:"device,attr"`
+	Target  struct {
+		DiskName string `xml:"dev,attr"`
+		DiskBus  string `xml:"bus,attr"`
+	} `xml:"target"`
+	Serial string `xml:"serial"`
+	Driver struct {
+		Name  string `xml:"name,attr"`
+		Type  string `xml:"type,attr"`
+		Cache string `xml:"cache,attr"`
+	} `xml:"driver"`
+	Source       DiskSource    `xml:"source"`
+	BackingStore *BackingStore `xml:"backingStore"`
+	Alias        struct {
+		Name string `xml:"name,attr"`
+	} `xml:"alias"`
+}
+type DiskSource struct {
+	File     string           `xml:"file,attr"`
+	Dev      string           `xml:"dev,attr"`
+	Pool     string           `xml:"pool,attr"`
+	Volume   string           `xml:"volume,attr"`
+	Protocol string           `xml:"protocol,attr"`
+	Name     string           `xml:"name,attr"`
+	Hosts    []DiskSourceHost `xml:"host"`
+}
+type DiskSourceHost struct {
+	Name string `xml:"name,attr"`
+	Port string `xml:"port,attr"`
+}
+type BackingStore struct {
+	Index  int    `xml:"index,attr"`
+	Type   string `xml:"type,attr"`
+	Format struct {
+		Type string `xml:"type,attr"`
+	} `xml:"format"`
+	Source       DiskSource    `xml:"source"`
+	BackingStore *BackingStore `xml:"backingStore"`
+}
+type Interface struct {
+	XMLName xml.Name `xml:"interface"`
+	Type    string   `xml:"type,attr"`
+	Target  struct {
+		Dev string `xml:"dev,attr"`
+	} `xml:"target"`
+	MAC struct {
+		Address string `xml:"address,attr"`
+	} `xml:"mac"`
+	Model struct {
+		Type string `xml:"type,attr"`
+	} `xml:"model"`
+	Source struct {
+		Bridge  string `xml:"bridge,attr"`
+		Network string `xml:"network,attr"`
+		Dev     string `xml:"dev,attr"`
+	} `xml:"source"`
+}
+type MemBalloon struct {
+	XMLName xml.Name `xml:"memballoon"`
+	Model   string   `xml:"model,attr"`
+	Stats   struct {
+		Period int `xml:"period,attr"`
+	} `xml:"stats"`
+}
+type Devices struct {
+	XMLName    xml.Name    `xml:"devices"`
+	Disks      []Disk      `xml:"disk"`
+	Interfaces []Interface `xml:"interface"`
+	MemBalloon *MemBalloon `xml:"memballoon"`
+}
+type DomainDesc struct {
+	Name    string  `xml:"name"`
+	UUID    string  `xml:"uuid"`
+	Devices Devices `xml:"devices"`
+}
+
+// ParseDomainXML decodes the domain XML description returned by libvirt.
+func ParseDomainXML(x string) (*DomainDesc, error) {
+	var D DomainDesc
+	err := xml.Unmarshal([]byte(x), &D)
+	if err != nil {
+		return nil, err
+	}
+	return &D, nil
+}
@@ -0,0 +1,45 @@
+package collector
+
+type errMessage struct {
+	message string
+}
+
+func errNoSuchDomain(dom string) *errMessage {
+	return &errMessage{
+		message: (dom + ": no such domain"),
+	}
+}
+
+func errNoDomains() *errMessage {
+	return &errMessage{
+		message: ("no domains found"),
+	}
+}
+
+func errNoSuchDisk(serial string) *errMessage {
+	if serial != "all" {
+		return &errMessage{
+			message: (serial + ": no such disk"),
+		}
+	}
+	return &errMessage{
+		message: ("no disks found"),
+	}
+}
+
+func (e *errMessage) Error() string {
+	return e.message
+}
+
+func errNoSuchInterface(iface string) *errMessage {
+	return &errMessage{
+		message: (iface + ": no such interface"),
+	}
+}
+
+// IsNotFound reports whether err is caused by a domain
+// or a device which does not exist.
+func IsNotFound(err error) bool {
+	_, ok := err.(*errMessage)
+	return ok
+}
@@ -0,0 +1,35 @@
+package collector
+
+// DomainInventory describes a domain and its devices.
+type DomainInventory struct {
+	Domain
+	Info       DomainInfo
+	Disks      []Disk
+	Interfaces []Interface
+}
+
+// Inventory describes every domain in doms, active or not.
+func Inventory(b Backend, doms []Domain) ([]DomainInventory, error) {
+	var inv []DomainInventory
+	for _, dom := range doms {
+		info, err := b.DomainInfo(dom.UUID)
+		if err != nil {
+			return nil, err
+		}
+		x, err := b.DomainXML(dom.UUID)
+		if err != nil {
+			return nil, err
+		}
+		desc, err := ParseDomainXML(x)
+		if err != nil {
+			return nil, err
+		}
+		inv = append(inv, DomainInventory{
+			Domain:     dom,
+			Info:       info,
+			Disks:      desc.Devices.Disks,
+			Interfaces: desc.Devices.Interfaces,
+		})
+	}
+	return inv, nil
+}
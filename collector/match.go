@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// isRegexp reports whether pattern is a /regexp/.
+func isRegexp(pattern string) bool {
+	return len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// matcher returns a function reporting whether domain matches pattern.
+// pattern is a domain name or uuid, a shell glob or a /regexp/.
+func matcher(pattern string) (func(Domain) bool, error) {
+	if isRegexp(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return func(d Domain) bool {
+			return re.MatchString(d.Name)
+		}, nil
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+		return func(d Domain) bool {
+			ok, _ := path.Match(pattern, d.Name)
+			return ok
+		}, nil
+	}
+	return func(d Domain) bool {
+		return d.Name == pattern || d.UUID == pattern
+	}, nil
+}
+
+// MatchDomains returns active domains matching any of patterns,
+// see matcher for patterns syntax. Every domain is returned if
+// there are no patterns. Every pattern must match at least one domain.
+func MatchDomains(b Backend, patterns []string) ([]Domain, error) {
+	doms, err := b.ListDomains()
+	if err != nil {
+		return nil, err
+	}
+	return matchDomains(doms, patterns)
+}
+
+// MatchAllDomains is MatchDomains matching inactive domains as well.
+func MatchAllDomains(b Backend, patterns []string) ([]Domain, error) {
+	doms, err := b.ListAllDomains()
+	if err != nil {
+		return nil, err
+	}
+	return matchDomains(doms, patterns)
+}
+
+// filterDomains returns domains matching any of patterns, every
+// domain if there are no patterns. Unlike matchDomains it is fine
+// if a pattern matches nothing.
+func filterDomains(doms []Domain, patterns []string) ([]Domain, error) {
+	if len(patterns) == 0 {
+		return doms, nil
+	}
+	var matchers []func(Domain) bool
+	for _, p := range patterns {
+		match, err := matcher(p)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, match)
+	}
+	var res []Domain
+	for _, d := range doms {
+		for _, match := range matchers {
+			if match(d) {
+				res = append(res, d)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func matchDomains(doms []Domain, patterns []string) ([]Domain, error) {
+	if len(patterns) == 0 {
+		if len(doms) == 0 {
+			return nil, errNoDomains()
+		}
+		return doms, nil
+	}
+	matched := make([]bool, len(doms))
+	for _, p := range patterns {
+		match, err := matcher(p)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for i, d := range doms {
+			if match(d) {
+				matched[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, errNoSuchDomain(p)
+		}
+	}
+	var res []Domain
+	for i, d := range doms {
+		if matched[i] {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
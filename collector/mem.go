@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"time"
+)
+
+// MemorySample is a snapshot of domain memory statistics taken at Time.
+type MemorySample struct {
+	Domain string
+	UUID   string
+	Time   time.Time
+	Stats  MemoryStats
+}
+
+// MemoryDelta holds current memory statistics of a domain in Stats
+// and counters difference between two samples in Change.
+type MemoryDelta struct {
+	Domain   string
+	UUID     string
+	Time     time.Time
+	Interval time.Duration
+	Stats    MemoryStats
+	Change   MemoryStats
+	// Reset is set if counters were reset since the previous sample
+	Reset bool
+}
+
+// Sub returns swap and faults counters difference s - o.
+func (s MemoryStats) Sub(o MemoryStats) MemoryStats {
+	return MemoryStats{
+		GuestReported: s.GuestReported && o.GuestReported,
+		SwapIn:        s.SwapIn - o.SwapIn,
+		SwapOut:       s.SwapOut - o.SwapOut,
+		MajorFault:    s.MajorFault - o.MajorFault,
+		MinorFault:    s.MinorFault - o.MinorFault,
+	}
+}
+
+// NewMemory creates a collector for memory statistics of dom.
+// If period is positive and the balloon driver of dom has no
+// statistics period configured, it is set to period seconds,
+// otherwise guests report nothing.
+func NewMemory(b Backend, dom Domain, period int) (*Collector, error) {
+	c, desc, err := newCollector(b, dom)
+	if err != nil {
+		return nil, err
+	}
+	mb := desc.Devices.MemBalloon
+	if mb == nil || mb.Model == "none" {
+		return c, nil
+	}
+	c.memPeriod = mb.Stats.Period
+	if c.memPeriod == 0 && period > 0 {
+		err = b.SetMemoryStatsPeriod(dom.UUID, period)
+		if err != nil {
+			return nil, err
+		}
+		c.memPeriod = period
+	}
+	return c, nil
+}
+
+// NewAllMemory creates collectors for memory statistics of every
+// domain in doms, see NewMemory.
+func NewAllMemory(b Backend, doms []Domain, period int) ([]*Collector, error) {
+	if len(doms) == 0 {
+		return nil, errNoDomains()
+	}
+	var cols []*Collector
+	for _, dom := range doms {
+		c, err := NewMemory(b, dom, period)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// Domain returns the domain being sampled.
+func (c *Collector) Domain() Domain {
+	return c.dom
+}
+
+// MemoryStatsPeriod returns balloon driver statistics period
+// of the domain, zero if guest statistics are not polled.
+func (c *Collector) MemoryStatsPeriod() int {
+	return c.memPeriod
+}
+
+// SampleMemory reads current memory statistics of the domain.
+func (c *Collector) SampleMemory() (MemorySample, error) {
+	ms, err := c.backend.MemoryStats(c.dom.UUID)
+	t := now()
+	if err != nil {
+		return MemorySample{}, err
+	}
+	return MemorySample{
+		Domain: c.dom.Name,
+		UUID:   c.dom.UUID,
+		Time:   t,
+		Stats:  ms,
+	}, nil
+}
+
+// SampleAllMemory samples memory statistics of every collector.
+// Guest statistics are only reported per domain, so there is no bulk path.
+func SampleAllMemory(cols []*Collector) ([]MemorySample, error) {
+	var samples []MemorySample
+	for _, c := range cols {
+		s, err := c.SampleMemory()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// DiffMemory matches current samples with previous ones by domain.
+// Domains without a previous sample get zero change, changes of
+// counters which went backwards are marked Reset.
+func DiffMemory(prev, cur []MemorySample) []MemoryDelta {
+	byUUID := make(map[string]*MemorySample, len(prev))
+	for i := range prev {
+		byUUID[prev[i].UUID] = &prev[i]
+	}
+	deltas := make([]MemoryDelta, 0, len(cur))
+	for _, c := range cur {
+		d := MemoryDelta{
+			Domain: c.Domain,
+			UUID:   c.UUID,
+			Time:   c.Time,
+			Stats:  c.Stats,
+		}
+		if p, ok := byUUID[c.UUID]; ok {
+			if s := c.Stats.Sub(p.Stats); s.negative() {
+				d.Reset = true
+			} else {
+				d.Interval = c.Time.Sub(p.Time)
+				d.Change = s
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"time"
+)
+
+// InterfaceSample is a snapshot of one network interface counters
+// taken at Time.
+type InterfaceSample struct {
+	Domain    string
+	UUID      string
+	Interface Interface
+	Time      time.Time
+	Stats     InterfaceStats
+}
+
+// InterfaceDelta is a counters difference between two samples
+// of the same network interface, Total holds counters of the current one.
+type InterfaceDelta struct {
+	Domain    string
+	UUID      string
+	Interface Interface
+	Time      time.Time
+	Interval  time.Duration
+	Stats     InterfaceStats
+	Total     InterfaceStats
+	// Reset is set if counters were reset since the previous sample
+	Reset bool
+}
+
+// Sub returns counters difference s - o.
+func (s InterfaceStats) Sub(o InterfaceStats) InterfaceStats {
+	return InterfaceStats{
+		RxBytes:   s.RxBytes - o.RxBytes,
+		RxPackets: s.RxPackets - o.RxPackets,
+		RxErrs:    s.RxErrs - o.RxErrs,
+		RxDrop:    s.RxDrop - o.RxDrop,
+		TxBytes:   s.TxBytes - o.TxBytes,
+		TxPackets: s.TxPackets - o.TxPackets,
+		TxErrs:    s.TxErrs - o.TxErrs,
+		TxDrop:    s.TxDrop - o.TxDrop,
+	}
+}
+
+// NewNet creates a collector for network interfaces of dom matching
+// iface. iface is a target device name or MAC address, "all" matches
+// every interface. Interfaces without target device are skipped.
+func NewNet(b Backend, dom Domain, iface string) (*Collector, error) {
+	c, desc, err := newCollector(b, dom)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range desc.Devices.Interfaces {
+		if v.Target.Dev == "" {
+			continue
+		}
+		if iface != "all" && iface != v.Target.Dev && iface != v.MAC.Address {
+			continue
+		}
+		c.ifaces = append(c.ifaces, v)
+	}
+	if len(c.ifaces) == 0 {
+		return nil, errNoSuchInterface(iface)
+	}
+	return c, nil
+}
+
+// NewAllNet creates collectors for network interfaces matching iface
+// of every domain in doms. Domains without such interfaces are skipped.
+func NewAllNet(b Backend, doms []Domain, iface string) ([]*Collector, error) {
+	return newAll(doms, func(dom Domain) (*Collector, error) {
+		return NewNet(b, dom, iface)
+	}, errNoSuchInterface(iface))
+}
+
+// Interfaces returns network interfaces being sampled.
+func (c *Collector) Interfaces() []Interface {
+	return c.ifaces
+}
+
+// SampleInterfaces reads current counters of every collected
+// network interface.
+func (c *Collector) SampleInterfaces() ([]InterfaceSample, error) {
+	var samples []InterfaceSample
+	for _, v := range c.ifaces {
+		dis, err := c.backend.InterfaceStats(c.dom.UUID, v.Target.Dev)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, InterfaceSample{
+			Domain:    c.dom.Name,
+			UUID:      c.dom.UUID,
+			Interface: v,
+			Time:      now(),
+			Stats:     dis,
+		})
+	}
+	return samples, nil
+}
+
+// SampleAllInterfaces samples network interfaces of every collector,
+// see SampleAll.
+func SampleAllInterfaces(cols []*Collector) ([]InterfaceSample, error) {
+	var samples []InterfaceSample
+	single, groups := groupBulk(cols)
+	for _, c := range single {
+		s, err := c.SampleInterfaces()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s...)
+	}
+	for _, g := range groups {
+		byUUID, t, err := g.fetch(StatsInterface)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range g.cols {
+			ds, ok := byUUID[c.dom.UUID]
+			if !ok {
+				return nil, errNoSuchDomain(c.dom.Name)
+			}
+			for _, v := range c.ifaces {
+				dis, ok := ds.Interface[v.Target.Dev]
+				if !ok {
+					return nil, errNoSuchInterface(v.Target.Dev)
+				}
+				samples = append(samples, InterfaceSample{
+					Domain:    c.dom.Name,
+					UUID:      c.dom.UUID,
+					Interface: v,
+					Time:      t,
+					Stats:     dis,
+				})
+			}
+		}
+	}
+	return samples, nil
+}
+
+// DiffInterfaces matches current samples with previous ones by domain
+// and interface and returns counters differences. Interfaces without
+// a previous sample get zero delta, deltas of counters which went
+// backwards are marked Reset.
+func DiffInterfaces(prev, cur []InterfaceSample) []InterfaceDelta {
+	type key struct {
+		uuid  string
+		iface string
+	}
+	byKey := make(map[key]*InterfaceSample, len(prev))
+	for i := range prev {
+		byKey[key{prev[i].UUID, prev[i].Interface.Target.Dev}] = &prev[i]
+	}
+	deltas := make([]InterfaceDelta, 0, len(cur))
+	for _, c := range cur {
+		d := InterfaceDelta{
+			Domain:    c.Domain,
+			UUID:      c.UUID,
+			Interface: c.Interface,
+			Time:      c.Time,
+			Total:     c.Stats,
+		}
+		if p, ok := byKey[key{c.UUID, c.Interface.Target.Dev}]; ok {
+			if s := c.Stats.Sub(p.Stats); s.negative() {
+				d.Reset = true
+			} else {
+				d.Interval = c.Time.Sub(p.Time)
+				d.Stats = s
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
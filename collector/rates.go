@@ -0,0 +1,332 @@
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+// perSecond returns v per second over interval d,
+// zero if there is no interval yet.
+func perSecond(v int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(v) / d.Seconds()
+}
+
+// percent returns ns nanoseconds as percentage of interval d.
+func percent(ns int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(ns) / float64(d) * 100
+}
+
+// await returns average time of a request in milliseconds.
+func await(totalTimes, reqs int64) float64 {
+	if reqs <= 0 {
+		return 0
+	}
+	return float64(totalTimes) / float64(reqs) / float64(time.Millisecond)
+}
+
+// DiskRates holds per second rates of a disk.
+// Awaits are in milliseconds.
+type DiskRates struct {
+	RdReq      float64
+	WrReq      float64
+	FlushReq   float64
+	RdKB       float64
+	WrKB       float64
+	RdAwait    float64
+	WrAwait    float64
+	FlushAwait float64
+	Errs       float64
+}
+
+// Rates computes per second rates of d over the measured interval.
+func (d Delta) Rates() DiskRates {
+	return DiskRates{
+		RdReq:      perSecond(d.Stats.RdReq, d.Interval),
+		WrReq:      perSecond(d.Stats.WrReq, d.Interval),
+		FlushReq:   perSecond(d.Stats.FlushReq, d.Interval),
+		RdKB:       perSecond(d.Stats.RdBytes, d.Interval) / 1024,
+		WrKB:       perSecond(d.Stats.WrBytes, d.Interval) / 1024,
+		RdAwait:    await(d.Stats.RdTotalTimes, d.Stats.RdReq),
+		WrAwait:    await(d.Stats.WrTotalTimes, d.Stats.WrReq),
+		FlushAwait: await(d.Stats.FlushTotalTimes, d.Stats.FlushReq),
+		Errs:       perSecond(d.Stats.Errs, d.Interval),
+	}
+}
+
+// reqSize returns average request size in KiB.
+func reqSize(bytes, reqs int64) float64 {
+	if reqs <= 0 {
+		return 0
+	}
+	return float64(bytes) / float64(reqs) / 1024
+}
+
+// ExtendedDiskRates holds iostat -x like metrics of a disk.
+// Request sizes are in KiB, awaits are in milliseconds.
+// Await is the average time of read and write requests, as flushes
+// carry no data; QueueSize includes time spent on flushes, like
+// aqu-sz of iostat does.
+type ExtendedDiskRates struct {
+	DiskRates
+	RdReqSize float64
+	WrReqSize float64
+	Await     float64
+	QueueSize float64
+}
+
+// ExtendedRates computes extended metrics of d over the measured interval.
+func (d Delta) ExtendedRates() ExtendedDiskRates {
+	r := ExtendedDiskRates{
+		DiskRates: d.Rates(),
+		RdReqSize: reqSize(d.Stats.RdBytes, d.Stats.RdReq),
+		WrReqSize: reqSize(d.Stats.WrBytes, d.Stats.WrReq),
+		Await: await(d.Stats.RdTotalTimes+d.Stats.WrTotalTimes,
+			d.Stats.RdReq+d.Stats.WrReq),
+	}
+	if d.Interval > 0 {
+		totalTimes := d.Stats.RdTotalTimes + d.Stats.WrTotalTimes + d.Stats.FlushTotalTimes
+		r.QueueSize = float64(totalTimes) / float64(d.Interval)
+	}
+	return r
+}
+
+// CapThreshold is utilization of a limit, percent, from which
+// a disk is considered to run at its cap. Throttled rates hover
+// slightly below the limit, so it is not exactly 100.
+const CapThreshold = 99.0
+
+// limitPercent returns rate as percentage of limit, -1 if no limit.
+func limitPercent(rate float64, limit int64) float64 {
+	if limit <= 0 {
+		return -1
+	}
+	return rate / float64(limit) * 100
+}
+
+// ThrottleRates holds disk rates as percentage of its I/O limits.
+// Percentages are negative if there is no such limit. IOPSMax and
+// BWMax are utilization of the tightest total, read or write burst
+// limit. Capped is set if any sustained limit is reached.
+type ThrottleRates struct {
+	DiskRates
+	Group     string
+	IOPS      float64
+	ReadIOPS  float64
+	WriteIOPS float64
+	BW        float64
+	ReadBW    float64
+	WriteBW   float64
+	IOPSMax   float64
+	BWMax     float64
+	Capped    bool
+}
+
+// ThrottleRates computes utilization of d limits over the measured
+// interval. All percentages are negative if limits are not loaded.
+func (d Delta) ThrottleRates() ThrottleRates {
+	r := ThrottleRates{
+		DiskRates: d.Rates(),
+		IOPS:      -1,
+		ReadIOPS:  -1,
+		WriteIOPS: -1,
+		BW:        -1,
+		ReadBW:    -1,
+		WriteBW:   -1,
+		IOPSMax:   -1,
+		BWMax:     -1,
+	}
+	t := d.IoTune
+	if t == nil {
+		return r
+	}
+	r.Group = t.GroupName
+	iops := r.RdReq + r.WrReq
+	rdBW := perSecond(d.Stats.RdBytes, d.Interval)
+	wrBW := perSecond(d.Stats.WrBytes, d.Interval)
+	r.IOPS = limitPercent(iops, t.TotalIopsSec)
+	r.ReadIOPS = limitPercent(r.RdReq, t.ReadIopsSec)
+	r.WriteIOPS = limitPercent(r.WrReq, t.WriteIopsSec)
+	r.BW = limitPercent(rdBW+wrBW, t.TotalBytesSec)
+	r.ReadBW = limitPercent(rdBW, t.ReadBytesSec)
+	r.WriteBW = limitPercent(wrBW, t.WriteBytesSec)
+	for _, p := range []float64{
+		limitPercent(iops, t.TotalIopsSecMax),
+		limitPercent(r.RdReq, t.ReadIopsSecMax),
+		limitPercent(r.WrReq, t.WriteIopsSecMax),
+	} {
+		if p > r.IOPSMax {
+			r.IOPSMax = p
+		}
+	}
+	for _, p := range []float64{
+		limitPercent(rdBW+wrBW, t.TotalBytesSecMax),
+		limitPercent(rdBW, t.ReadBytesSecMax),
+		limitPercent(wrBW, t.WriteBytesSecMax),
+	} {
+		if p > r.BWMax {
+			r.BWMax = p
+		}
+	}
+	for _, p := range []float64{r.IOPS, r.ReadIOPS, r.WriteIOPS, r.BW, r.ReadBW, r.WriteBW} {
+		if p >= CapThreshold {
+			r.Capped = true
+		}
+	}
+	return r
+}
+
+// InterfaceRates holds per second rates of a network interface.
+type InterfaceRates struct {
+	RxPackets float64
+	TxPackets float64
+	RxKB      float64
+	TxKB      float64
+	RxErrs    float64
+	TxErrs    float64
+	RxDrop    float64
+	TxDrop    float64
+}
+
+// Rates computes per second rates of d over the measured interval.
+func (d InterfaceDelta) Rates() InterfaceRates {
+	return InterfaceRates{
+		RxPackets: perSecond(d.Stats.RxPackets, d.Interval),
+		TxPackets: perSecond(d.Stats.TxPackets, d.Interval),
+		RxKB:      perSecond(d.Stats.RxBytes, d.Interval) / 1024,
+		TxKB:      perSecond(d.Stats.TxBytes, d.Interval) / 1024,
+		RxErrs:    perSecond(d.Stats.RxErrs, d.Interval),
+		TxErrs:    perSecond(d.Stats.TxErrs, d.Interval),
+		RxDrop:    perSecond(d.Stats.RxDrop, d.Interval),
+		TxDrop:    perSecond(d.Stats.TxDrop, d.Interval),
+	}
+}
+
+// VcpuRates holds vcpu usage as percentage of the interval.
+type VcpuRates struct {
+	Number int
+	Usage  float64
+	CPU    int
+	State  string
+}
+
+// CPURates holds domain cpu usage as percentage of the interval.
+// Usage of a domain with several vcpus may exceed 100%.
+type CPURates struct {
+	CPU    float64
+	User   float64
+	System float64
+	Vcpus  []VcpuRates
+}
+
+// Rates computes cpu usage of d over the measured interval.
+func (d CPUDelta) Rates() CPURates {
+	r := CPURates{
+		CPU:    percent(d.Stats.CPUTime, d.Interval),
+		User:   percent(d.Stats.UserTime, d.Interval),
+		System: percent(d.Stats.SystemTime, d.Interval),
+	}
+	for _, v := range d.Vcpus {
+		vr := VcpuRates{
+			Number: v.Number,
+			Usage:  percent(v.Time, d.Interval),
+			CPU:    v.CPU,
+			State:  v.StateName(),
+		}
+		r.Vcpus = append(r.Vcpus, vr)
+	}
+	return r
+}
+
+// MemoryRates holds memory sizes in KiB and per second rates
+// of swap, KiB, and page faults.
+type MemoryRates struct {
+	Actual     int64
+	RSS        int64
+	Unused     int64
+	Available  int64
+	Usable     int64
+	DiskCaches int64
+	SwapIn     float64
+	SwapOut    float64
+	MajorFault float64
+	MinorFault float64
+}
+
+// Rates computes memory rates of d over the measured interval.
+func (d MemoryDelta) Rates() MemoryRates {
+	return MemoryRates{
+		Actual:     d.Stats.ActualBalloon,
+		RSS:        d.Stats.RSS,
+		Unused:     d.Stats.Unused,
+		Available:  d.Stats.Available,
+		Usable:     d.Stats.Usable,
+		DiskCaches: d.Stats.DiskCaches,
+		SwapIn:     perSecond(d.Change.SwapIn, d.Interval),
+		SwapOut:    perSecond(d.Change.SwapOut, d.Interval),
+		MajorFault: perSecond(d.Change.MajorFault, d.Interval),
+		MinorFault: perSecond(d.Change.MinorFault, d.Interval),
+	}
+}
+
+// CapacityRates holds disk sizes in MiB, allocation as percentage
+// of capacity and allocation growth in KiB per second. TimeToFull
+// estimates when allocation reaches capacity at the current growth,
+// it is negative if allocation does not grow or grows so slowly
+// the estimate overflows a Duration, about 292 years.
+type CapacityRates struct {
+	Capacity   float64
+	Allocation float64
+	Physical   float64
+	Used       float64
+	Growth     float64
+	TimeToFull time.Duration
+}
+
+// Rates computes capacity rates of d over the measured interval.
+func (d CapacityDelta) Rates() CapacityRates {
+	const mib = 1024 * 1024
+	r := CapacityRates{
+		Capacity:   float64(d.Info.Capacity) / mib,
+		Allocation: float64(d.Info.Allocation) / mib,
+		Physical:   float64(d.Info.Physical) / mib,
+		Growth:     perSecond(d.Growth, d.Interval) / 1024,
+		TimeToFull: -1,
+	}
+	if d.Info.Capacity > 0 {
+		r.Used = float64(d.Info.Allocation) / float64(d.Info.Capacity) * 100
+	}
+	if d.Growth > 0 && d.Interval > 0 {
+		left := d.Info.Capacity - d.Info.Allocation
+		if left < 0 {
+			left = 0
+		}
+		if full := float64(left) / float64(d.Growth) * float64(d.Interval); full < math.MaxInt64 {
+			r.TimeToFull = time.Duration(full)
+		}
+	}
+	return r
+}
+
+// LayerRates holds per second rates of a backing chain layer along
+// with its allocation, MiB, and allocation growth, KiB per second.
+type LayerRates struct {
+	DiskRates
+	Allocation float64
+	Growth     float64
+}
+
+// Rates computes layer rates of d over the measured interval.
+func (d LayerDelta) Rates() LayerRates {
+	c := CapacityDelta{Interval: d.Interval, Info: d.Info, Growth: d.Growth}.Rates()
+	return LayerRates{
+		DiskRates:  Delta{Interval: d.Interval, Stats: d.Stats}.Rates(),
+		Allocation: c.Allocation,
+		Growth:     c.Growth,
+	}
+}
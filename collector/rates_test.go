@@ -0,0 +1,288 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const rateDomainXML = `<domain><devices>
+<disk><target dev="vda" bus="virtio"/></disk>
+</devices></domain>`
+
+// fakeClock replaces now for the duration of a test.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func setClock() (*fakeClock, func()) {
+	c := &fakeClock{t: time.Unix(1540000000, 0)}
+	now = c.now
+	return c, func() { now = time.Now }
+}
+
+// slowBackend takes delay of the fake clock to answer every stats call.
+type slowBackend struct {
+	Backend
+	clock *fakeClock
+	delay time.Duration
+}
+
+func (b *slowBackend) BlockStats(uuid, disk string) (BlockStats, error) {
+	b.clock.advance(b.delay)
+	return b.Backend.BlockStats(uuid, disk)
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// sampleRates samples a disk twice sleeping pause between samples
+// and returns resulting rates.
+func sampleRates(t *testing.T, b Backend, clock *fakeClock, pause time.Duration) DiskRates {
+	dom := Domain{Name: "vm", UUID: "u-1"}
+	col, err := New(b, dom, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, err := SampleAll([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(pause)
+	cur, err := SampleAll([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltas := Diff(prev, cur)
+	if len(deltas) != 1 {
+		t.Fatalf("got %d deltas, want 1", len(deltas))
+	}
+	return deltas[0].Rates()
+}
+
+func TestLowRate(t *testing.T) {
+	clock, restore := setClock()
+	defer restore()
+	// Both bulk and per domain paths
+	for _, bulk := range []bool{true, false} {
+		b := NewScriptedBackend()
+		b.AddDomain("vm", "u-1", rateDomainXML)
+		b.AddBlockStats("u-1", "vda",
+			BlockStats{},
+			BlockStats{RdReq: 1, RdBytes: 4096, RdTotalTimes: 3 * int64(time.Millisecond)})
+		var backend Backend = b
+		if !bulk {
+			backend = perDomainBackend{b}
+		}
+		r := sampleRates(t, backend, clock, 2*time.Second)
+		if !almostEqual(r.RdReq, 0.5) {
+			t.Errorf("r/s = %v, want 0.5", r.RdReq)
+		}
+		if !almostEqual(r.RdKB, 2) {
+			t.Errorf("rkB/s = %v, want 2", r.RdKB)
+		}
+		// Await is based on the request delta, not on the rate
+		if !almostEqual(r.RdAwait, 3) {
+			t.Errorf("r_await = %v, want 3", r.RdAwait)
+		}
+	}
+}
+
+func TestSlowCall(t *testing.T) {
+	clock, restore := setClock()
+	defer restore()
+	b := NewScriptedBackend()
+	b.AddDomain("vm", "u-1", rateDomainXML)
+	b.AddBlockStats("u-1", "vda",
+		BlockStats{},
+		BlockStats{WrReq: 100, WrTotalTimes: 100 * int64(time.Millisecond)})
+
+	// A second of sleep and 1.5 seconds spent in the second call
+	r := sampleRates(t, perDomainBackend{&slowBackend{Backend: b, clock: clock, delay: 1500 * time.Millisecond}}, clock, time.Second)
+	if !almostEqual(r.WrReq, 40) {
+		t.Errorf("w/s = %v, want 40", r.WrReq)
+	}
+	if !almostEqual(r.WrAwait, 1) {
+		t.Errorf("w_await = %v, want 1", r.WrAwait)
+	}
+}
+
+func TestFirstSample(t *testing.T) {
+	_, restore := setClock()
+	defer restore()
+	b := NewScriptedBackend()
+	b.AddDomain("vm", "u-1", rateDomainXML)
+	b.AddBlockStats("u-1", "vda", BlockStats{RdReq: 10, RdTotalTimes: 10})
+	col, err := New(b, Domain{Name: "vm", UUID: "u-1"}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := col.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Diff(nil, cur)[0].Rates()
+	if r != (DiskRates{}) {
+		t.Errorf("first sample rates = %+v, want zero", r)
+	}
+}
+
+func TestCPUPercentOfMeasuredInterval(t *testing.T) {
+	clock, restore := setClock()
+	defer restore()
+	b := NewScriptedBackend()
+	b.AddDomain("vm", "u-1", rateDomainXML)
+	b.AddCPUStats("u-1",
+		CPUStats{},
+		CPUStats{CPUTime: int64(time.Second), UserTime: int64(time.Second / 2)})
+	b.AddVcpuStats("u-1",
+		[]VcpuStats{{Number: 0, State: VcpuRunning, CPU: 2}},
+		[]VcpuStats{{Number: 0, State: VcpuRunning, CPU: 3, Time: int64(time.Second)}})
+	cols, err := NewAllCPU(b, []Domain{{Name: "vm", UUID: "u-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, err := SampleAllCPU(cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(4 * time.Second)
+	cur, err := SampleAllCPU(cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := DiffCPU(prev, cur)[0].Rates()
+	if !almostEqual(r.CPU, 25) || !almostEqual(r.User, 12.5) {
+		t.Errorf("cpu = %v, user = %v, want 25, 12.5", r.CPU, r.User)
+	}
+	if len(r.Vcpus) != 1 || !almostEqual(r.Vcpus[0].Usage, 25) || r.Vcpus[0].CPU != 3 {
+		t.Errorf("vcpus = %+v, want 25%% on cpu 3", r.Vcpus)
+	}
+}
+
+func TestExtendedRates(t *testing.T) {
+	d := Delta{
+		Interval: 2 * time.Second,
+		Stats: BlockStats{
+			RdReq:           10,
+			RdBytes:         10 * 64 * 1024,
+			RdTotalTimes:    10 * int64(time.Millisecond),
+			WrReq:           30,
+			WrBytes:         30 * 4096,
+			WrTotalTimes:    90 * int64(time.Millisecond),
+			FlushReq:        5,
+			FlushTotalTimes: 900 * int64(time.Millisecond),
+		},
+	}
+	r := d.ExtendedRates()
+	if !almostEqual(r.RdReqSize, 64) || !almostEqual(r.WrReqSize, 4) {
+		t.Errorf("rareq-sz = %v, wareq-sz = %v, want 64, 4", r.RdReqSize, r.WrReqSize)
+	}
+	// (10ms + 90ms) / 40 requests, flushes are not counted
+	if !almostEqual(r.Await, 2.5) {
+		t.Errorf("await = %v, want 2.5", r.Await)
+	}
+	// 1s of requests time, flushes included, over 2s
+	if !almostEqual(r.QueueSize, 0.5) {
+		t.Errorf("aqu-sz = %v, want 0.5", r.QueueSize)
+	}
+}
+
+func TestThrottleRates(t *testing.T) {
+	d := Delta{
+		Interval: 2 * time.Second,
+		Stats: BlockStats{
+			RdReq:   100,
+			RdBytes: 100 * 4096,
+			WrReq:   300,
+			WrBytes: 300 * 4096,
+		},
+	}
+	r := d.ThrottleRates()
+	if r.IOPS >= 0 || r.BWMax >= 0 || r.Capped {
+		t.Errorf("got %+v without limits", r)
+	}
+
+	d.IoTune = &IoTune{
+		TotalIopsSec:     200,
+		ReadIopsSec:      100,
+		TotalIopsSecMax:  400,
+		WriteBytesSecMax: 1024 * 1024,
+		GroupName:        "tenant",
+	}
+	r = d.ThrottleRates()
+	// 200 IOPS over 2s against 200 IOPS total limit
+	if !almostEqual(r.IOPS, 100) || !r.Capped {
+		t.Errorf("%%iops = %v, capped = %v, want 100, true", r.IOPS, r.Capped)
+	}
+	if !almostEqual(r.ReadIOPS, 50) || r.WriteIOPS >= 0 {
+		t.Errorf("%%r_iops = %v, %%w_iops = %v, want 50, unknown", r.ReadIOPS, r.WriteIOPS)
+	}
+	if !almostEqual(r.IOPSMax, 50) {
+		t.Errorf("%%iops_max = %v, want 50", r.IOPSMax)
+	}
+	// 600kB/s of writes against 1MB/s burst
+	if !almostEqual(r.BWMax, 150*4096*100/float64(1024*1024)) || r.BW >= 0 {
+		t.Errorf("%%bw_max = %v, %%bw = %v", r.BWMax, r.BW)
+	}
+	if r.Group != "tenant" {
+		t.Errorf("group = %q, want tenant", r.Group)
+	}
+}
+
+func TestCapacityGrowth(t *testing.T) {
+	clock, restore := setClock()
+	defer restore()
+	const gib = 1024 * 1024 * 1024
+	b := NewScriptedBackend()
+	b.AddDomain("vm", "u-1", rateDomainXML)
+	b.AddBlockStats("u-1", "vda", BlockStats{})
+	b.AddBlockInfo("u-1", "vda",
+		BlockInfo{Capacity: 10 * gib, Allocation: 4 * gib, Physical: 5 * gib},
+		BlockInfo{Capacity: 10 * gib, Allocation: 5 * gib, Physical: 5 * gib},
+	)
+	col, err := New(b, Domain{Name: "vm", UUID: "u-1"}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, err := SampleAllCapacity([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := DiffCapacity(nil, prev)[0].Rates()
+	if r.TimeToFull >= 0 || !almostEqual(r.Used, 40) {
+		t.Errorf("first sample: %+v", r)
+	}
+	clock.advance(time.Minute)
+	cur, err := SampleAllCapacity([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = DiffCapacity(prev, cur)[0].Rates()
+	// 1GiB a minute, 5GiB left
+	if !almostEqual(r.Growth, 1024*1024/60.0) {
+		t.Errorf("growth = %v kB/s", r.Growth)
+	}
+	if r.TimeToFull != 5*time.Minute {
+		t.Errorf("time to full = %v, want 5m", r.TimeToFull)
+	}
+
+	// A byte a day of 16TiB overflows a Duration, never full
+	d := CapacityDelta{
+		Interval: 24 * time.Hour,
+		Info:     BlockInfo{Capacity: 16 << 40, Allocation: 1 << 30},
+		Growth:   1,
+	}
+	if r := d.Rates(); r.TimeToFull != -1 {
+		t.Errorf("tiny growth: time to full = %v, want never", r.TimeToFull)
+	}
+}
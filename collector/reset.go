@@ -0,0 +1,26 @@
+package collector
+
+/* Counters only grow while a domain runs. A difference
+ * going negative means they were reset in between,
+ * the domain was restarted or migrated, so the interval
+ * carries no rates.
+ */
+
+func (s BlockStats) negative() bool {
+	return s.RdReq < 0 || s.RdBytes < 0 || s.RdTotalTimes < 0 ||
+		s.WrReq < 0 || s.WrBytes < 0 || s.WrTotalTimes < 0 ||
+		s.FlushReq < 0 || s.FlushTotalTimes < 0 || s.Errs < 0
+}
+
+func (s InterfaceStats) negative() bool {
+	return s.RxBytes < 0 || s.RxPackets < 0 || s.RxErrs < 0 || s.RxDrop < 0 ||
+		s.TxBytes < 0 || s.TxPackets < 0 || s.TxErrs < 0 || s.TxDrop < 0
+}
+
+func (s CPUStats) negative() bool {
+	return s.CPUTime < 0 || s.UserTime < 0 || s.SystemTime < 0
+}
+
+func (s MemoryStats) negative() bool {
+	return s.SwapIn < 0 || s.SwapOut < 0 || s.MajorFault < 0 || s.MinorFault < 0
+}
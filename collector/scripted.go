@@ -0,0 +1,374 @@
+package collector
+
+import (
+	"sync"
+)
+
+// ScriptedBackend is an in-memory Backend replaying pre-defined
+// counters sequences. Every stats call returns the next element of
+// the sequence, the last one is repeated when the sequence is over.
+type ScriptedBackend struct {
+	mu      sync.Mutex
+	domains []*scriptedDomain
+	byUUID  map[string]*scriptedDomain
+	handle  func(Event)
+}
+
+type scriptedDomain struct {
+	dom   Domain
+	state DomainInfo
+	xml   string
+	block map[string][]BlockStats
+	info  map[string][]BlockInfo
+	tune  map[string]IoTune
+	iface map[string][]InterfaceStats
+	cpu   []CPUStats
+	vcpu  [][]VcpuStats
+	mem   []MemoryStats
+	// period is the memory statistics period set
+	period int
+	calls  map[string]int
+}
+
+// NewScriptedBackend returns an empty scripted backend.
+func NewScriptedBackend() *ScriptedBackend {
+	return &ScriptedBackend{
+		byUUID: make(map[string]*scriptedDomain),
+	}
+}
+
+// AddDomain adds an active domain with the given XML description.
+func (b *ScriptedBackend) AddDomain(name, uuid, xml string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := &scriptedDomain{
+		dom:   Domain{Name: name, UUID: uuid},
+		state: DomainInfo{State: DomainRunning},
+		xml:   xml,
+		block: make(map[string][]BlockStats),
+		info:  make(map[string][]BlockInfo),
+		tune:  make(map[string]IoTune),
+		iface: make(map[string][]InterfaceStats),
+		calls: make(map[string]int),
+	}
+	b.domains = append(b.domains, d)
+	b.byUUID[uuid] = d
+}
+
+// SetDomainInfo sets state, vcpus and memory of the domain.
+// Domains are running unless set otherwise, shut off ones are
+// only listed by ListAllDomains.
+func (b *ScriptedBackend) SetDomainInfo(uuid string, info DomainInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.state = info
+	}
+}
+
+// SetDomainXML replaces XML description of the domain,
+// like attaching or detaching a device does.
+func (b *ScriptedBackend) SetDomainXML(uuid, xml string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.xml = xml
+	}
+}
+
+// AddBlockStats appends counters to the disk sequence.
+func (b *ScriptedBackend) AddBlockStats(uuid, disk string, seq ...BlockStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.block[disk] = append(d.block[disk], seq...)
+	}
+}
+
+// AddBlockInfo appends sizes to the disk sizes sequence.
+func (b *ScriptedBackend) AddBlockInfo(uuid, disk string, seq ...BlockInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.info[disk] = append(d.info[disk], seq...)
+	}
+}
+
+// SetIoTune sets I/O limits of the disk.
+func (b *ScriptedBackend) SetIoTune(uuid, disk string, t IoTune) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.tune[disk] = t
+	}
+}
+
+// AddInterfaceStats appends counters to the interface sequence.
+func (b *ScriptedBackend) AddInterfaceStats(uuid, iface string, seq ...InterfaceStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.iface[iface] = append(d.iface[iface], seq...)
+	}
+}
+
+// AddCPUStats appends counters to the domain cpu sequence.
+func (b *ScriptedBackend) AddCPUStats(uuid string, seq ...CPUStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.cpu = append(d.cpu, seq...)
+	}
+}
+
+// AddVcpuStats appends vcpus statistics to the domain vcpu sequence.
+func (b *ScriptedBackend) AddVcpuStats(uuid string, seq ...[]VcpuStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.vcpu = append(d.vcpu, seq...)
+	}
+}
+
+// AddMemoryStats appends statistics to the domain memory sequence.
+func (b *ScriptedBackend) AddMemoryStats(uuid string, seq ...MemoryStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		d.mem = append(d.mem, seq...)
+	}
+}
+
+func (b *ScriptedBackend) find(uuid string) *scriptedDomain {
+	return b.byUUID[uuid]
+}
+
+// next returns position in a sequence of length n for key
+// and advances it.
+func (d *scriptedDomain) next(key string, n int) int {
+	i := d.calls[key]
+	d.calls[key]++
+	if i >= n {
+		i = n - 1
+	}
+	return i
+}
+
+func (b *ScriptedBackend) ListDomains() ([]Domain, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var doms []Domain
+	for _, d := range b.domains {
+		if d.state.State != DomainShutoff {
+			doms = append(doms, d.dom)
+		}
+	}
+	return doms, nil
+}
+
+func (b *ScriptedBackend) ListAllDomains() ([]Domain, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var doms []Domain
+	for _, d := range b.domains {
+		doms = append(doms, d.dom)
+	}
+	return doms, nil
+}
+
+func (b *ScriptedBackend) DomainInfo(uuid string) (DomainInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return DomainInfo{}, errNoSuchDomain(uuid)
+	}
+	return d.state, nil
+}
+
+func (b *ScriptedBackend) DomainXML(uuid string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return "", errNoSuchDomain(uuid)
+	}
+	return d.xml, nil
+}
+
+func (b *ScriptedBackend) BlockStats(uuid, disk string) (BlockStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return BlockStats{}, errNoSuchDomain(uuid)
+	}
+	seq := d.block[disk]
+	if len(seq) == 0 {
+		return BlockStats{}, errNoSuchDisk(disk)
+	}
+	return seq[d.next("block/"+disk, len(seq))], nil
+}
+
+func (b *ScriptedBackend) BlockInfo(uuid, disk string) (BlockInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return BlockInfo{}, errNoSuchDomain(uuid)
+	}
+	seq := d.info[disk]
+	if len(seq) == 0 {
+		return BlockInfo{}, errNoSuchDisk(disk)
+	}
+	return seq[d.next("info/"+disk, len(seq))], nil
+}
+
+func (b *ScriptedBackend) BlockIoTune(uuid, disk string) (IoTune, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return IoTune{}, errNoSuchDomain(uuid)
+	}
+	if _, ok := d.block[disk]; !ok {
+		return IoTune{}, errNoSuchDisk(disk)
+	}
+	return d.tune[disk], nil
+}
+
+func (b *ScriptedBackend) InterfaceStats(uuid, iface string) (InterfaceStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return InterfaceStats{}, errNoSuchDomain(uuid)
+	}
+	seq := d.iface[iface]
+	if len(seq) == 0 {
+		return InterfaceStats{}, errNoSuchInterface(iface)
+	}
+	return seq[d.next("iface/"+iface, len(seq))], nil
+}
+
+func (b *ScriptedBackend) CPUStats(uuid string) (CPUStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return CPUStats{}, errNoSuchDomain(uuid)
+	}
+	if len(d.cpu) == 0 {
+		return CPUStats{}, nil
+	}
+	return d.cpu[d.next("cpu", len(d.cpu))], nil
+}
+
+func (b *ScriptedBackend) VcpuStats(uuid string) ([]VcpuStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return nil, errNoSuchDomain(uuid)
+	}
+	if len(d.vcpu) == 0 {
+		return nil, nil
+	}
+	return d.vcpu[d.next("vcpu", len(d.vcpu))], nil
+}
+
+func (b *ScriptedBackend) MemoryStats(uuid string) (MemoryStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return MemoryStats{}, errNoSuchDomain(uuid)
+	}
+	if len(d.mem) == 0 {
+		return MemoryStats{}, nil
+	}
+	return d.mem[d.next("mem", len(d.mem))], nil
+}
+
+// AllDomainStats advances sequences of groups of the requested
+// domains, as if each of them was queried separately.
+func (b *ScriptedBackend) AllDomainStats(uuids []string, groups StatsGroup) ([]DomainStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []DomainStats
+	for _, uuid := range uuids {
+		d := b.find(uuid)
+		if d == nil {
+			continue
+		}
+		ds := DomainStats{
+			UUID:      uuid,
+			Block:     make(map[string]BlockStats),
+			BlockInfo: make(map[string]BlockInfo),
+			Interface: make(map[string]InterfaceStats),
+		}
+		if groups&StatsBlock != 0 {
+			for disk, seq := range d.block {
+				ds.Block[disk] = seq[d.next("block/"+disk, len(seq))]
+			}
+			for disk, seq := range d.info {
+				ds.BlockInfo[disk] = seq[d.next("info/"+disk, len(seq))]
+			}
+		}
+		if groups&StatsInterface != 0 {
+			for iface, seq := range d.iface {
+				ds.Interface[iface] = seq[d.next("iface/"+iface, len(seq))]
+			}
+		}
+		res = append(res, ds)
+	}
+	return res, nil
+}
+
+// AllDomainStatsBacking is AllDomainStats, backing chain layers
+// are scripted as disks named like "vda[1]".
+func (b *ScriptedBackend) AllDomainStatsBacking(uuids []string) ([]DomainStats, error) {
+	return b.AllDomainStats(uuids, StatsBlock)
+}
+
+func (b *ScriptedBackend) SetMemoryStatsPeriod(uuid string, period int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := b.find(uuid)
+	if d == nil {
+		return errNoSuchDomain(uuid)
+	}
+	d.period = period
+	return nil
+}
+
+// MemoryStatsPeriod returns the period set by SetMemoryStatsPeriod.
+func (b *ScriptedBackend) MemoryStatsPeriod(uuid string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.find(uuid); d != nil {
+		return d.period
+	}
+	return 0
+}
+
+func (b *ScriptedBackend) Subscribe(handle func(Event)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handle = handle
+	return nil
+}
+
+// Emit delivers e to the subscriber, if any.
+func (b *ScriptedBackend) Emit(e Event) {
+	b.mu.Lock()
+	handle := b.handle
+	b.mu.Unlock()
+	if handle != nil {
+		handle(e)
+	}
+}
+
+func (b *ScriptedBackend) Close() error {
+	return nil
+}
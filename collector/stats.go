@@ -0,0 +1,241 @@
+package collector
+
+import (
+	"time"
+)
+
+// BlockStats holds raw block device counters of a single disk.
+// Times are in nanoseconds, as reported by libvirt.
+type BlockStats struct {
+	RdReq           int64
+	RdBytes         int64
+	RdTotalTimes    int64
+	WrReq           int64
+	WrBytes         int64
+	WrTotalTimes    int64
+	FlushReq        int64
+	FlushTotalTimes int64
+	Errs            int64
+}
+
+// Sub returns counters difference s - o.
+func (s BlockStats) Sub(o BlockStats) BlockStats {
+	return BlockStats{
+		RdReq:           s.RdReq - o.RdReq,
+		RdBytes:         s.RdBytes - o.RdBytes,
+		RdTotalTimes:    s.RdTotalTimes - o.RdTotalTimes,
+		WrReq:           s.WrReq - o.WrReq,
+		WrBytes:         s.WrBytes - o.WrBytes,
+		WrTotalTimes:    s.WrTotalTimes - o.WrTotalTimes,
+		FlushReq:        s.FlushReq - o.FlushReq,
+		FlushTotalTimes: s.FlushTotalTimes - o.FlushTotalTimes,
+		Errs:            s.Errs - o.Errs,
+	}
+}
+
+// IoTune holds I/O limits of a disk, zero means no limit.
+// Max limits are burst limits. Disks sharing limits
+// belong to the same GroupName.
+type IoTune struct {
+	TotalBytesSec    int64
+	ReadBytesSec     int64
+	WriteBytesSec    int64
+	TotalIopsSec     int64
+	ReadIopsSec      int64
+	WriteIopsSec     int64
+	TotalBytesSecMax int64
+	ReadBytesSecMax  int64
+	WriteBytesSecMax int64
+	TotalIopsSecMax  int64
+	ReadIopsSecMax   int64
+	WriteIopsSecMax  int64
+	GroupName        string
+}
+
+// BlockInfo holds sizes of a disk, bytes. Capacity is the size seen
+// by the guest, Allocation is the highest written offset or the space
+// used in the backing volume, Physical is the size of the volume itself.
+type BlockInfo struct {
+	Capacity   int64
+	Allocation int64
+	Physical   int64
+}
+
+// InterfaceStats holds raw counters of a single network interface.
+type InterfaceStats struct {
+	RxBytes   int64
+	RxPackets int64
+	RxErrs    int64
+	RxDrop    int64
+	TxBytes   int64
+	TxPackets int64
+	TxErrs    int64
+	TxDrop    int64
+}
+
+// CPUStats holds cpu time consumed by a domain, nanoseconds.
+type CPUStats struct {
+	CPUTime    int64
+	UserTime   int64
+	SystemTime int64
+}
+
+// Domain states, see virDomainState.
+const (
+	DomainNoState     = 0
+	DomainRunning     = 1
+	DomainBlocked     = 2
+	DomainPaused      = 3
+	DomainShutdown    = 4
+	DomainShutoff     = 5
+	DomainCrashed     = 6
+	DomainPMSuspended = 7
+)
+
+// DomainInfo holds state, number of vcpus and memory of a domain,
+// memory is in KiB.
+type DomainInfo struct {
+	State     int
+	Vcpus     int
+	Memory    int64
+	MaxMemory int64
+}
+
+// StateName returns human readable domain state.
+func (i DomainInfo) StateName() string {
+	switch i.State {
+	case DomainNoState:
+		return "nostate"
+	case DomainRunning:
+		return "running"
+	case DomainBlocked:
+		return "blocked"
+	case DomainPaused:
+		return "paused"
+	case DomainShutdown:
+		return "shutdown"
+	case DomainShutoff:
+		return "shutoff"
+	case DomainCrashed:
+		return "crashed"
+	case DomainPMSuspended:
+		return "pmsuspended"
+	}
+	return "unknown"
+}
+
+// Vcpu states, see virVcpuState.
+const (
+	VcpuOffline = 0
+	VcpuRunning = 1
+	VcpuBlocked = 2
+)
+
+// VcpuStats holds statistics of a single vcpu.
+// Time is in nanoseconds. CPU is the physical cpu the vcpu
+// last ran on, -1 if unknown.
+type VcpuStats struct {
+	Number int
+	State  int
+	Time   int64
+	CPU    int
+}
+
+// StateName returns human readable vcpu state.
+func (v VcpuStats) StateName() string {
+	switch v.State {
+	case VcpuOffline:
+		return "offline"
+	case VcpuRunning:
+		return "running"
+	case VcpuBlocked:
+		return "blocked"
+	}
+	return "unknown"
+}
+
+// MemoryStats holds memory statistics of a domain.
+// Sizes are in KiB, faults and swap counters are cumulative.
+// GuestReported is set if the balloon driver reports guest statistics,
+// they are zero otherwise.
+type MemoryStats struct {
+	GuestReported bool
+	SwapIn        int64
+	SwapOut       int64
+	MajorFault    int64
+	MinorFault    int64
+	Unused        int64
+	Available     int64
+	ActualBalloon int64
+	RSS           int64
+	Usable        int64
+	DiskCaches    int64
+	LastUpdate    int64
+}
+
+// Sample is a snapshot of one disk counters taken at Time.
+// IoTune is set if disk limits are loaded, see LoadIoTune.
+type Sample struct {
+	Domain string
+	UUID   string
+	Disk   Disk
+	Time   time.Time
+	Stats  BlockStats
+	IoTune *IoTune
+}
+
+// Delta is a counters difference between two samples of the same disk,
+// Total holds counters of the current one.
+type Delta struct {
+	Domain   string
+	UUID     string
+	Disk     Disk
+	Time     time.Time
+	Interval time.Duration
+	Stats    BlockStats
+	Total    BlockStats
+	IoTune   *IoTune
+	// Reset is set if counters were reset since the previous sample,
+	// Stats and Interval are zero then.
+	Reset bool
+}
+
+// Diff matches current samples with previous ones by domain and disk
+// and returns counters differences. Disks without a previous sample
+// get zero delta, deltas of counters which went backwards are marked Reset.
+func Diff(prev, cur []Sample) []Delta {
+	type key struct {
+		uuid string
+		disk string
+	}
+	byKey := make(map[key]*Sample, len(prev))
+	for i := range prev {
+		byKey[key{prev[i].UUID, prev[i].Disk.Target.DiskName}] = &prev[i]
+	}
+	deltas := make([]Delta, 0, len(cur))
+	for _, c := range cur {
+		d := Delta{
+			Domain: c.Domain,
+			UUID:   c.UUID,
+			Disk:   c.Disk,
+			Time:   c.Time,
+			Total:  c.Stats,
+			IoTune: c.IoTune,
+		}
+		if p, ok := byKey[key{c.UUID, c.Disk.Target.DiskName}]; ok {
+			if s := c.Stats.Sub(p.Stats); s.negative() {
+				d.Reset = true
+			} else {
+				d.Interval = c.Time.Sub(p.Time)
+				d.Stats = s
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+// now returns current time with a monotonic clock reading,
+// so that intervals between samples are not affected by wall
+// clock changes. Tests replace it.
+var now = time.Now
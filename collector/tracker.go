@@ -0,0 +1,346 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind tells what an Event is about.
+type EventKind int
+
+const (
+	// EventChange is a domain or a sampled device found coming
+	// or going by a tracker
+	EventChange EventKind = iota
+	// EventLifecycle is a domain defined, started or stopped
+	EventLifecycle
+	// EventState is a running domain paused or resumed
+	EventState
+	// EventDeviceAdded is a device attached, Device is its alias
+	EventDeviceAdded
+	// EventDeviceRemoved is a device detached, Device is its alias
+	EventDeviceRemoved
+	// EventIOError is a disk failing I/O, Device is its alias
+	EventIOError
+	// EventBlockThreshold is a disk written past its threshold
+	EventBlockThreshold
+)
+
+// Event is a change of a monitored domain or of its devices.
+// Device is empty for domain wide events.
+type Event struct {
+	Time    time.Time
+	Kind    EventKind
+	Domain  string
+	UUID    string
+	Device  string
+	Message string
+}
+
+// tracked is a domain followed by a tracker.
+type tracked struct {
+	dom Domain
+	// col is nil if the domain has none of the requested devices
+	col *Collector
+	// devices holds targets of every disk and interface,
+	// nil until they are read for the first time
+	devices []string
+	// aliases maps disks aliases to their targets
+	aliases map[string]string
+	// seeded is set until devices of a domain passed
+	// to NewTracker are read
+	seeded bool
+}
+
+/* Tracker follows domains matching patterns as they start, stop,
+ * migrate away and back, or get devices attached and detached.
+ * Collectors are created with newf and kept as long as devices
+ * of their domain stay the same, so whatever they loaded
+ * survives a refresh. Devices of every domain are inspected on
+ * each refresh unless the tracker is subscribed to events, then
+ * only domains which had some are.
+ */
+type Tracker struct {
+	backend  Backend
+	patterns []string
+	newf     func(Domain) (*Collector, error)
+	domains  map[string]*tracked
+	// order holds uuids of tracked domains in listing order
+	order []string
+	// gone holds uuids of domains which went away
+	gone map[string]bool
+	cols []*Collector
+	// subscribed is set if events are delivered, full
+	// until the first refresh inspects every domain
+	subscribed bool
+	full       bool
+	mu         sync.Mutex
+	pending    []Event
+}
+
+// NewTracker returns a tracker of domains doms monitored by cols,
+// domains without a collector have none of the requested devices.
+func NewTracker(b Backend, patterns []string, doms []Domain, cols []*Collector, newf func(Domain) (*Collector, error)) *Tracker {
+	t := &Tracker{
+		backend:  b,
+		patterns: patterns,
+		newf:     newf,
+		domains:  make(map[string]*tracked),
+		gone:     make(map[string]bool),
+		cols:     cols,
+		full:     true,
+	}
+	for _, dom := range doms {
+		t.domains[dom.UUID] = &tracked{dom: dom, seeded: true}
+		t.order = append(t.order, dom.UUID)
+	}
+	for _, c := range cols {
+		if _, ok := t.domains[c.dom.UUID]; !ok {
+			t.order = append(t.order, c.dom.UUID)
+		}
+		t.domains[c.dom.UUID] = &tracked{dom: c.dom, col: c, seeded: true}
+	}
+	return t
+}
+
+// Collectors returns collectors of the domains being monitored.
+func (t *Tracker) Collectors() []*Collector {
+	return t.cols
+}
+
+// Subscribe makes the tracker follow events of its backend if it
+// implements EventBackend, it reports whether it does.
+func (t *Tracker) Subscribe() (bool, error) {
+	eb, ok := t.backend.(EventBackend)
+	if !ok {
+		return false, nil
+	}
+	if err := eb.Subscribe(t.notify); err != nil {
+		return false, err
+	}
+	t.subscribed = true
+	return true, nil
+}
+
+// notify queues e until the next refresh.
+func (t *Tracker) notify(e Event) {
+	t.mu.Lock()
+	t.pending = append(t.pending, e)
+	t.mu.Unlock()
+}
+
+// devices returns targets of every disk and interface of dom
+// and aliases of its disks.
+func (t *Tracker) devices(dom Domain) ([]string, map[string]string, error) {
+	x, err := t.backend.DomainXML(dom.UUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	desc, err := ParseDomainXML(x)
+	if err != nil {
+		return nil, nil, err
+	}
+	devices := []string{}
+	aliases := make(map[string]string)
+	for _, v := range desc.Devices.Disks {
+		devices = append(devices, "disk "+v.Target.DiskName)
+		if v.Alias.Name != "" {
+			aliases[v.Alias.Name] = v.Target.DiskName
+		}
+	}
+	for _, v := range desc.Devices.Interfaces {
+		devices = append(devices, "interface "+v.Target.Dev)
+	}
+	return devices, aliases, nil
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// targets returns names of disks and interfaces sampled by c,
+// none if c is nil.
+func (c *Collector) targets() (disks, ifaces []string) {
+	if c == nil {
+		return nil, nil
+	}
+	for _, v := range c.disks {
+		disks = append(disks, v.Target.DiskName)
+	}
+	for _, v := range c.ifaces {
+		ifaces = append(ifaces, v.Target.Dev)
+	}
+	return disks, ifaces
+}
+
+// missing returns elements of a which are not in b.
+func missing(a, b []string) []string {
+	var res []string
+	for _, s := range a {
+		found := false
+		for _, o := range b {
+			if s == o {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+/* Refresh lists domains again and updates collectors. It returns
+ * events of domains appeared, disappeared or reappeared with the
+ * same uuid, and of sampled devices attached or detached, along
+ * with state, I/O error and threshold events of tracked domains
+ * delivered since the previous refresh.
+ * A domain which fails to be inspected is reported as an event
+ * and keeps its previous collector, it has likely just stopped.
+ */
+func (t *Tracker) Refresh() ([]Event, error) {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	// stale holds uuids of domains which devices may have changed
+	stale := make(map[string]bool)
+	for _, e := range pending {
+		switch e.Kind {
+		case EventLifecycle, EventDeviceAdded, EventDeviceRemoved:
+			stale[e.UUID] = true
+		}
+	}
+	all, err := t.backend.ListDomains()
+	if err != nil {
+		return nil, err
+	}
+	doms, err := filterDomains(all, t.patterns)
+	if err != nil {
+		return nil, err
+	}
+	at := now()
+	var events []Event
+	event := func(dom Domain, device, message string) {
+		events = append(events, Event{
+			Time:    at,
+			Domain:  dom.Name,
+			UUID:    dom.UUID,
+			Device:  device,
+			Message: message,
+		})
+	}
+	active := make(map[string]*tracked, len(doms))
+	var order []string
+	var cols []*Collector
+	for _, dom := range doms {
+		tr, ok := t.domains[dom.UUID]
+		if !ok {
+			if t.gone[dom.UUID] {
+				event(dom, "", "domain reappeared")
+				delete(t.gone, dom.UUID)
+			} else {
+				event(dom, "", "domain appeared")
+			}
+			tr = &tracked{dom: dom}
+		}
+		tr.dom = dom
+		if !ok || !t.subscribed || t.full || stale[dom.UUID] {
+			if err := t.inspect(tr, event); err != nil {
+				event(dom, "", err.Error())
+			}
+		}
+		active[dom.UUID] = tr
+		order = append(order, dom.UUID)
+		if tr.col != nil {
+			cols = append(cols, tr.col)
+		}
+	}
+	for _, uuid := range t.order {
+		if _, ok := active[uuid]; !ok {
+			event(t.domains[uuid].dom, "", "domain disappeared")
+			t.gone[uuid] = true
+		}
+	}
+	for _, e := range pending {
+		tr, ok := active[e.UUID]
+		if !ok {
+			continue
+		}
+		switch e.Kind {
+		case EventIOError, EventBlockThreshold:
+			if target, ok := tr.aliases[e.Device]; ok {
+				e.Device = target
+			}
+			fallthrough
+		case EventState:
+			events = append(events, e)
+		}
+	}
+	t.domains = active
+	t.order = order
+	t.cols = cols
+	t.full = false
+	return events, nil
+}
+
+// inspect reads devices of tr and updates its collector
+// if they changed.
+func (t *Tracker) inspect(tr *tracked, event func(Domain, string, string)) error {
+	devices, aliases, err := t.devices(tr.dom)
+	if err != nil {
+		return err
+	}
+	switch {
+	case tr.seeded:
+		tr.seeded = false
+		tr.devices = devices
+	case tr.devices == nil || !sameStrings(devices, tr.devices):
+		if err := t.update(tr, devices, event); err != nil {
+			return err
+		}
+	}
+	tr.aliases = aliases
+	return nil
+}
+
+// update replaces collector of tr after its devices changed
+// and reports sampled devices attached and detached, unless
+// devices of tr are read for the first time.
+func (t *Tracker) update(tr *tracked, devices []string, event func(Domain, string, string)) error {
+	c, err := t.newf(tr.dom)
+	if IsNotFound(err) {
+		c, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	if tr.devices != nil {
+		oldDisks, oldIfaces := tr.col.targets()
+		disks, ifaces := c.targets()
+		for _, v := range missing(disks, oldDisks) {
+			event(tr.dom, v, "disk attached")
+		}
+		for _, v := range missing(oldDisks, disks) {
+			event(tr.dom, v, "disk detached")
+		}
+		for _, v := range missing(ifaces, oldIfaces) {
+			event(tr.dom, v, "interface attached")
+		}
+		for _, v := range missing(oldIfaces, ifaces) {
+			event(tr.dom, v, "interface detached")
+		}
+	}
+	tr.col = c
+	tr.devices = devices
+	return nil
+}
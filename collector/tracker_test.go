@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+const twoDisksXML = `<domain><devices>
+<disk><target dev="vda" bus="virtio"/></disk>
+<disk><target dev="vdb" bus="virtio"/></disk>
+</devices></domain>`
+
+func messages(events []Event) []string {
+	var res []string
+	for _, e := range events {
+		m := e.Domain + ": " + e.Message
+		if e.Device != "" {
+			m = e.Domain + " " + e.Device + ": " + e.Message
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+func TestTracker(t *testing.T) {
+	b := NewScriptedBackend()
+	b.AddDomain("vm1", "u-1", rateDomainXML)
+	b.AddDomain("vm2", "u-2", rateDomainXML)
+	doms, err := MatchDomains(b, []string{"vm*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols, err := NewAll(b, doms, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTracker(b, []string{"vm*"}, doms, cols, func(dom Domain) (*Collector, error) {
+		return New(b, dom, "all")
+	})
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+		cols   int
+	}{
+		{"unchanged", func() {}, nil, 2},
+		{"stop", func() {
+			b.SetDomainInfo("u-2", DomainInfo{State: DomainShutoff})
+		}, []string{"vm2: domain disappeared"}, 1},
+		{"attach", func() {
+			b.SetDomainXML("u-1", twoDisksXML)
+		}, []string{"vm1 vdb: disk attached"}, 1},
+		{"start", func() {
+			b.SetDomainInfo("u-2", DomainInfo{State: DomainRunning})
+			b.AddDomain("vm3", "u-3", rateDomainXML)
+			b.AddDomain("other", "u-4", rateDomainXML)
+		}, []string{"vm2: domain reappeared", "vm3: domain appeared"}, 3},
+		{"detach", func() {
+			b.SetDomainXML("u-1", rateDomainXML)
+		}, []string{"vm1 vdb: disk detached"}, 3},
+	}
+	for _, s := range steps {
+		s.change()
+		events, err := tr.Refresh()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		got := messages(events)
+		if !sameStrings(got, s.want) {
+			t.Errorf("%s: events %q, want %q", s.name, got, s.want)
+		}
+		if n := len(tr.Collectors()); n != s.cols {
+			t.Errorf("%s: %d collectors, want %d", s.name, n, s.cols)
+		}
+	}
+}
+
+const aliasedDisksXML = `<domain><devices>
+<disk><target dev="vda" bus="virtio"/><alias name="virtio-disk0"/></disk>
+<disk><target dev="vdb" bus="virtio"/><alias name="virtio-disk1"/></disk>
+</devices></domain>`
+
+func TestTrackerEvents(t *testing.T) {
+	b := NewScriptedBackend()
+	b.AddDomain("vm1", "u-1", rateDomainXML)
+	doms := []Domain{{Name: "vm1", UUID: "u-1"}}
+	cols, err := NewAll(b, doms, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTracker(b, nil, doms, cols, func(dom Domain) (*Collector, error) {
+		return New(b, dom, "all")
+	})
+	if ok, err := tr.Subscribe(); !ok || err != nil {
+		t.Fatalf("Subscribe() = %v, %v", ok, err)
+	}
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"first", func() {}, nil},
+		// Without an event the description is not read again
+		{"silent", func() {
+			b.SetDomainXML("u-1", aliasedDisksXML)
+		}, nil},
+		{"added", func() {
+			b.Emit(Event{Kind: EventDeviceAdded, UUID: "u-1", Device: "virtio-disk1"})
+		}, []string{"vm1 vdb: disk attached"}},
+		{"ioerror", func() {
+			b.Emit(Event{Kind: EventIOError, Domain: "vm1", UUID: "u-1",
+				Device: "virtio-disk1", Message: "I/O error, domain paused"})
+			b.Emit(Event{Kind: EventState, Domain: "vm1", UUID: "u-1",
+				Message: "domain paused: I/O error"})
+			b.Emit(Event{Kind: EventIOError, Domain: "other", UUID: "u-9",
+				Device: "virtio-disk0", Message: "I/O error"})
+		}, []string{"vm1 vdb: I/O error, domain paused", "vm1: domain paused: I/O error"}},
+	}
+	for _, s := range steps {
+		s.change()
+		events, err := tr.Refresh()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		got := messages(events)
+		if !sameStrings(got, s.want) {
+			t.Errorf("%s: events %q, want %q", s.name, got, s.want)
+		}
+	}
+}
+
+func TestDiffReset(t *testing.T) {
+	clock, restore := setClock()
+	defer restore()
+	b := NewScriptedBackend()
+	b.AddDomain("vm", "u-1", rateDomainXML)
+	b.AddBlockStats("u-1", "vda",
+		BlockStats{RdReq: 100, WrReq: 100},
+		BlockStats{RdReq: 5, WrReq: 3})
+	col, err := New(b, Domain{Name: "vm", UUID: "u-1"}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, err := SampleAll([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(time.Second)
+	cur, err := SampleAll([]*Collector{col})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Diff(prev, cur)[0]
+	if !d.Reset {
+		t.Errorf("delta is not marked reset: %+v", d)
+	}
+	if r := d.Rates(); r.RdReq != 0 || r.WrReq != 0 {
+		t.Errorf("rates over a reset = %+v, want zero", r)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlexZzz/virtstat/collector"
+	"github.com/AlexZzz/virtstat/output"
+	"github.com/urfave/cli"
+)
+
+// shells lists shells completion scripts are available for.
+var shells = []string{"bash", "zsh"}
+
+/* Scripts call virtstat with the words typed so far
+ * followed by --generate-bash-completion and offer
+ * every printed line matching the current word
+ */
+const bashCompletion = `_%[1]s() {
+	local cur opts
+	COMPREPLY=()
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	opts=$("${COMP_WORDS[@]:0:$COMP_CWORD}" --generate-bash-completion 2>/dev/null)
+	COMPREPLY=($(compgen -W "${opts}" -- "${cur}"))
+	return 0
+}
+complete -F _%[1]s %[1]s
+`
+
+const zshCompletion = `#compdef %[1]s
+_%[1]s() {
+	local -a opts
+	opts=("${(@f)$(${words[1,CURRENT-1]} --generate-bash-completion 2>/dev/null)}")
+	compadd -a opts
+}
+compdef _%[1]s %[1]s
+`
+
+func printCompletion(c *cli.Context) error {
+	switch c.Args().First() {
+	case "bash":
+		fmt.Printf(bashCompletion, c.App.Name)
+	case "zsh":
+		fmt.Printf(zshCompletion, c.App.Name)
+	default:
+		return fmt.Errorf("shell is required, one of: %s", strings.Join(shells, ", "))
+	}
+	return nil
+}
+
+// flagNames returns names of flags as typed on the command line
+// and names of flags taking a value.
+func flagNames(flags []cli.Flag) (names []string, valued map[string]bool) {
+	valued = make(map[string]bool)
+	for _, f := range flags {
+		_, isBool := f.(cli.BoolFlag)
+		for _, n := range strings.Split(f.GetName(), ",") {
+			n = strings.TrimSpace(n)
+			if len(n) == 1 {
+				n = "-" + n
+			} else {
+				n = "--" + n
+			}
+			names = append(names, n)
+			if !isBool {
+				valued[n] = true
+			}
+		}
+	}
+	return names, valued
+}
+
+/* completeDomains completes the command line of a statistics
+ * command. Words are taken from os.Args: flags parsing is not
+ * reliable there, as the word being completed may be the value
+ * of the last flag.
+ */
+func completeDomains(c *cli.Context) {
+	names, valued := flagNames(c.Command.Flags)
+	words := os.Args[1 : len(os.Args)-1]
+	for i, w := range words {
+		if w == c.Command.Name {
+			words = words[i+1:]
+			break
+		}
+	}
+	var patterns []string
+	var last string
+	for i := 0; i < len(words); i++ {
+		last = words[i]
+		if !strings.HasPrefix(last, "-") {
+			patterns = append(patterns, last)
+			continue
+		}
+		if valued[last] && i+1 < len(words) {
+			i++
+			last = words[i]
+		}
+	}
+
+	switch last {
+	case "-f", "--format":
+		formats := output.Formats
+		if c.Command.Name == "list" {
+			formats = output.InventoryFormats
+		}
+		fmt.Println(strings.Join(formats, "\n"))
+		return
+	case "-d", "--disk", "-I", "--iface":
+		if setConnectURIs(c) == nil {
+			completeDevices(patterns, last == "-d" || last == "--disk")
+		}
+		return
+	}
+	if valued[last] {
+		return
+	}
+	for _, n := range names {
+		fmt.Println(n)
+	}
+	if setConnectURIs(c) != nil {
+		return
+	}
+	backend, err := openBackend(connectURIs[0], false)
+	if err != nil {
+		return
+	}
+	defer backend.Close()
+	doms, err := backend.ListDomains()
+	if err != nil {
+		return
+	}
+	for _, d := range doms {
+		fmt.Println(d.Name)
+	}
+}
+
+// completeDevices prints disks or interfaces targets of domains
+// matching patterns, of every domain if there are no patterns.
+func completeDevices(patterns []string, disks bool) {
+	backend, err := openBackend(connectURIs[0], false)
+	if err != nil {
+		return
+	}
+	defer backend.Close()
+	doms, err := collector.MatchDomains(backend, patterns)
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, dom := range doms {
+		x, err := backend.DomainXML(dom.UUID)
+		if err != nil {
+			continue
+		}
+		desc, err := collector.ParseDomainXML(x)
+		if err != nil {
+			continue
+		}
+		var targets []string
+		if disks {
+			for _, d := range desc.Devices.Disks {
+				targets = append(targets, d.Target.DiskName)
+			}
+		} else {
+			for _, i := range desc.Devices.Interfaces {
+				targets = append(targets, i.Target.Dev)
+			}
+		}
+		for _, t := range targets {
+			if t != "" && !seen[t] {
+				seen[t] = true
+				fmt.Println(t)
+			}
+		}
+	}
+}
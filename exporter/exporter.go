@@ -0,0 +1,141 @@
+// Package exporter serves domains statistics in Prometheus text format.
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// metric describes a counter exported for every disk.
+type metric struct {
+	name  string
+	help  string
+	value func(s collector.BlockStats) float64
+}
+
+var blockMetrics = []metric{
+	{"virtstat_block_read_requests_total", "Number of read requests.",
+		func(s collector.BlockStats) float64 { return float64(s.RdReq) }},
+	{"virtstat_block_read_bytes_total", "Number of bytes read.",
+		func(s collector.BlockStats) float64 { return float64(s.RdBytes) }},
+	{"virtstat_block_read_time_seconds_total", "Total time spent on read requests.",
+		func(s collector.BlockStats) float64 { return float64(s.RdTotalTimes) / 1e9 }},
+	{"virtstat_block_write_requests_total", "Number of write requests.",
+		func(s collector.BlockStats) float64 { return float64(s.WrReq) }},
+	{"virtstat_block_write_bytes_total", "Number of bytes written.",
+		func(s collector.BlockStats) float64 { return float64(s.WrBytes) }},
+	{"virtstat_block_write_time_seconds_total", "Total time spent on write requests.",
+		func(s collector.BlockStats) float64 { return float64(s.WrTotalTimes) / 1e9 }},
+	{"virtstat_block_flush_requests_total", "Number of flush requests.",
+		func(s collector.BlockStats) float64 { return float64(s.FlushReq) }},
+	{"virtstat_block_flush_time_seconds_total", "Total time spent on flush requests.",
+		func(s collector.BlockStats) float64 { return float64(s.FlushTotalTimes) / 1e9 }},
+	{"virtstat_block_errors_total", "Number of errors.",
+		func(s collector.BlockStats) float64 { return float64(s.Errs) }},
+}
+
+/* Handler serves metrics of every active domain of backend b.
+ * Scrapes are served one at a time, listing domains frees handles
+ * of domains gone which another scrape could be using.
+ */
+type Handler struct {
+	mu      sync.Mutex
+	backend collector.Backend
+}
+
+// NewHandler returns a metrics handler reading from b.
+func NewHandler(b collector.Backend) *Handler {
+	return &Handler{backend: b}
+}
+
+// collect samples disks of all active domains. Domains which fail
+// to be sampled, e.g. being shut down during scrape, are skipped.
+func (h *Handler) collect() ([]collector.Sample, error) {
+	doms, err := h.backend.ListDomains()
+	if err != nil {
+		return nil, err
+	}
+	var cols []*collector.Collector
+	for _, dom := range doms {
+		col, err := collector.New(h.backend, dom, "all")
+		if err != nil {
+			continue
+		}
+		cols = append(cols, col)
+	}
+	samples, err := collector.SampleAll(cols)
+	if err == nil {
+		return samples, nil
+	}
+	// Fall back to sampling domains one by one
+	samples = nil
+	for _, col := range cols {
+		s, err := col.Sample()
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		samples = append(samples, s...)
+	}
+	return samples, nil
+}
+
+// escape escapes a label value.
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// Write writes samples in Prometheus text exposition format.
+func Write(w io.Writer, samples []collector.Sample) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range blockMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s counter\n", m.name)
+		for _, s := range samples {
+			fmt.Fprintf(bw, "%s{domain=\"%s\",uuid=\"%s\",device=\"%s\",serial=\"%s\",bus=\"%s\"} %g\n",
+				m.name,
+				escape(s.Domain),
+				escape(s.UUID),
+				escape(s.Disk.Target.DiskName),
+				escape(s.Disk.Serial),
+				escape(s.Disk.Target.DiskBus),
+				m.value(s.Stats))
+		}
+	}
+	return bw.Flush()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	samples, err := h.collect()
+	h.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := Write(w, samples); err != nil {
+		log.Printf("writing metrics: %v", err)
+	}
+}
+
+// ListenAndServe serves metrics of backend b on addr at /metrics.
+func ListenAndServe(addr string, b collector.Backend) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", NewHandler(b))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "<html><body><a href=\"/metrics\">Metrics</a></body></html>\n")
+	})
+	return http.ListenAndServe(addr, mux)
+}
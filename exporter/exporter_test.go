@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+const diskXML = `<domain><devices>
+<disk><target dev="vda" bus="virtio"/><serial>a\b</serial></disk>
+</devices></domain>`
+
+// TestServeHTTP checks domains are exported with their labels escaped
+// when the bulk call fails for a domain gone during the scrape.
+func TestServeHTTP(t *testing.T) {
+	b := collector.NewScriptedBackend()
+	b.AddDomain("web \"1\"\n", "u-1", diskXML)
+	b.AddBlockStats("u-1", "vda", collector.BlockStats{RdReq: 3, WrBytes: 4096, RdTotalTimes: 5e8})
+	// No stats make the bulk call and sampling of the domain fail
+	b.AddDomain("gone", "u-2", diskXML)
+
+	rec := httptest.NewRecorder()
+	NewHandler(b).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	labels := `{domain="web \"1\"\n",uuid="u-1",device="vda",serial="a\\b",bus="virtio"}`
+	want := "# HELP virtstat_block_read_requests_total Number of read requests.\n" +
+		"# TYPE virtstat_block_read_requests_total counter\n" +
+		"virtstat_block_read_requests_total" + labels + " 3\n" +
+		"# HELP virtstat_block_read_bytes_total Number of bytes read.\n" +
+		"# TYPE virtstat_block_read_bytes_total counter\n" +
+		"virtstat_block_read_bytes_total" + labels + " 0\n" +
+		"# HELP virtstat_block_read_time_seconds_total Total time spent on read requests.\n" +
+		"# TYPE virtstat_block_read_time_seconds_total counter\n" +
+		"virtstat_block_read_time_seconds_total" + labels + " 0.5\n"
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, want) {
+		t.Errorf("got\n%swant prefix\n%s", body, want)
+	}
+	if !strings.Contains(body, "virtstat_block_write_bytes_total"+labels+" 4096\n") {
+		t.Errorf("write bytes missing from\n%s", body)
+	}
+	if strings.Contains(body, "gone") {
+		t.Errorf("domain failing to be sampled exported:\n%s", body)
+	}
+	if n := strings.Count(body, "# TYPE "); n != len(blockMetrics) {
+		t.Errorf("%d metrics typed, want %d", n, len(blockMetrics))
+	}
+}
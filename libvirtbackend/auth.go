@@ -0,0 +1,106 @@
+package libvirtbackend
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// Auth holds credentials for SASL authentication.
+type Auth struct {
+	Username string
+	Password string
+}
+
+/* LoadAuth reads credentials for libvirtd at host from a file of
+ * key=value lines with username and password keys, or from a libvirt
+ * auth.conf: credentials=NAME of section [auth-libvirt-HOST], or of
+ * [auth-libvirt-default], selects section [credentials-NAME]. A file
+ * of a single credentials section needs no auth section. Empty lines,
+ * comments starting with # and keys not needed are skipped.
+ */
+func LoadAuth(path, host string) (*Auth, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// sections holds keys by section name, "" before any section
+	sections := map[string]map[string]string{"": {}}
+	var credentials []string
+	section := ""
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			sections[section] = make(map[string]string)
+			if strings.HasPrefix(section, "credentials-") {
+				credentials = append(credentials, section)
+			}
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s:%d: key=value expected", path, n)
+		}
+		sections[section][strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	keys := sections[""]
+	if len(credentials) == 1 {
+		keys = sections[credentials[0]]
+	}
+	for _, name := range []string{"auth-libvirt-" + host, "auth-libvirt-default"} {
+		if auth, ok := sections[name]; ok {
+			c, ok := sections["credentials-"+auth["credentials"]]
+			if !ok {
+				return nil, fmt.Errorf("%s: [%s]: no credentials %q", path, name, auth["credentials"])
+			}
+			keys = c
+			break
+		}
+	}
+	a := &Auth{Username: keys["username"], Password: keys["password"]}
+	if v, ok := keys["authname"]; ok {
+		a.Username = v
+	}
+	if v, ok := keys["passphrase"]; ok {
+		a.Password = v
+	}
+	return a, nil
+}
+
+// connectAuth answers libvirt credential requests with a.
+func (a *Auth) connectAuth() *libvirt.ConnectAuth {
+	return &libvirt.ConnectAuth{
+		CredType: []libvirt.ConnectCredentialType{
+			libvirt.CRED_AUTHNAME,
+			libvirt.CRED_USERNAME,
+			libvirt.CRED_PASSPHRASE,
+			libvirt.CRED_NOECHOPROMPT,
+		},
+		Callback: func(creds []*libvirt.ConnectCredential) {
+			for _, c := range creds {
+				switch c.Type {
+				case libvirt.CRED_AUTHNAME, libvirt.CRED_USERNAME:
+					c.Result = a.Username
+				case libvirt.CRED_PASSPHRASE, libvirt.CRED_NOECHOPROMPT:
+					c.Result = a.Password
+				default:
+					continue
+				}
+				c.ResultLen = len(c.Result)
+			}
+		},
+	}
+}
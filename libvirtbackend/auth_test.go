@@ -0,0 +1,58 @@
+package libvirtbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const authConf = `[credentials-mon]
+authname=mon
+password=secret
+realm=example.com
+
+[credentials-admin]
+authname=admin
+password=root
+
+[auth-libvirt-kvm1]
+credentials=admin
+
+[auth-libvirt-default]
+credentials=mon
+`
+
+func TestLoadAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "virtstat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name     string
+		conf     string
+		host     string
+		username string
+		password string
+	}{
+		{"plain", "# SASL\nusername=mon\npassword=secret\n", "kvm1", "mon", "secret"},
+		{"single", "[credentials-mon]\nauthname=mon\npassword=secret\n", "kvm1", "mon", "secret"},
+		{"host", authConf, "kvm1", "admin", "root"},
+		{"default", authConf, "kvm2", "mon", "secret"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(path, []byte(tt.conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+		a, err := LoadAuth(path, tt.host)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if a.Username != tt.username || a.Password != tt.password {
+			t.Errorf("%s: got %+v", tt.name, a)
+		}
+	}
+}
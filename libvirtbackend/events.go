@@ -0,0 +1,173 @@
+package libvirtbackend
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+var (
+	eventLoop    sync.Once
+	eventLoopErr error
+)
+
+// eventLoopPause is the pause after the event loop fails,
+// an error repeating on every run would flood logs otherwise.
+const eventLoopPause = time.Second
+
+/* startEventLoop registers the default libvirt event loop
+ * implementation and runs it, once per process. Connections
+ * deliver events only if they are opened after that.
+ */
+func startEventLoop() error {
+	eventLoop.Do(func() {
+		eventLoopErr = libvirt.EventRegisterDefaultImpl()
+		if eventLoopErr != nil {
+			return
+		}
+		go func() {
+			for {
+				if err := libvirt.EventRunDefaultImpl(); err != nil {
+					log.Printf("libvirt event loop: %v", err)
+					time.Sleep(eventLoopPause)
+				}
+			}
+		}()
+	})
+	return eventLoopErr
+}
+
+// domainEvent returns an event of d, ok is false if d is gone already.
+func domainEvent(d *libvirt.Domain, kind collector.EventKind, device, message string) (collector.Event, bool) {
+	name, err := d.GetName()
+	if err != nil {
+		return collector.Event{}, false
+	}
+	uuid, err := d.GetUUIDString()
+	if err != nil {
+		return collector.Event{}, false
+	}
+	return collector.Event{
+		Time:    time.Now(),
+		Kind:    kind,
+		Domain:  name,
+		UUID:    uuid,
+		Device:  device,
+		Message: message,
+	}, true
+}
+
+var suspendedReasons = map[libvirt.DomainEventSuspendedDetailType]string{
+	libvirt.DOMAIN_EVENT_SUSPENDED_MIGRATED:        "migration",
+	libvirt.DOMAIN_EVENT_SUSPENDED_IOERROR:         "I/O error",
+	libvirt.DOMAIN_EVENT_SUSPENDED_WATCHDOG:        "watchdog",
+	libvirt.DOMAIN_EVENT_SUSPENDED_FROM_SNAPSHOT:   "snapshot",
+	libvirt.DOMAIN_EVENT_SUSPENDED_API_ERROR:       "API error",
+	libvirt.DOMAIN_EVENT_SUSPENDED_POSTCOPY:        "postcopy migration",
+	libvirt.DOMAIN_EVENT_SUSPENDED_POSTCOPY_FAILED: "postcopy migration failed",
+}
+
+// lifecycle returns kind and message of a lifecycle event.
+func lifecycle(e *libvirt.DomainEventLifecycle) (collector.EventKind, string) {
+	switch e.Event {
+	case libvirt.DOMAIN_EVENT_SUSPENDED:
+		if reason, ok := suspendedReasons[libvirt.DomainEventSuspendedDetailType(e.Detail)]; ok {
+			return collector.EventState, "domain paused: " + reason
+		}
+		return collector.EventState, "domain paused"
+	case libvirt.DOMAIN_EVENT_RESUMED:
+		return collector.EventState, "domain resumed"
+	case libvirt.DOMAIN_EVENT_PMSUSPENDED:
+		return collector.EventState, "domain suspended by guest"
+	case libvirt.DOMAIN_EVENT_CRASHED:
+		return collector.EventState, "domain crashed"
+	case libvirt.DOMAIN_EVENT_STARTED:
+		return collector.EventLifecycle, "domain started"
+	case libvirt.DOMAIN_EVENT_STOPPED:
+		return collector.EventLifecycle, "domain stopped"
+	case libvirt.DOMAIN_EVENT_SHUTDOWN:
+		return collector.EventLifecycle, "domain shutting down"
+	case libvirt.DOMAIN_EVENT_DEFINED:
+		return collector.EventLifecycle, "domain defined"
+	case libvirt.DOMAIN_EVENT_UNDEFINED:
+		return collector.EventLifecycle, "domain undefined"
+	}
+	return collector.EventLifecycle, "domain changed"
+}
+
+// ioError returns message of an I/O error event.
+func ioError(e *libvirt.DomainEventIOErrorReason) string {
+	msg := "I/O error"
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	switch e.Action {
+	case libvirt.DOMAIN_EVENT_IO_ERROR_PAUSE:
+		msg += ", domain paused"
+	case libvirt.DOMAIN_EVENT_IO_ERROR_REPORT:
+		msg += ", reported to guest"
+	}
+	return msg
+}
+
+/* Subscribe registers callbacks of lifecycle, device added and
+ * removed, I/O error and block threshold events of every domain.
+ * The connection must be opened with Config.Events set.
+ */
+func (b *Backend) Subscribe(handle func(collector.Event)) error {
+	emit := func(d *libvirt.Domain, kind collector.EventKind, device, message string) {
+		if e, ok := domainEvent(d, kind, device, message); ok {
+			handle(e)
+		}
+	}
+	register := []func() (int, error){
+		func() (int, error) {
+			return b.conn.DomainEventLifecycleRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, e *libvirt.DomainEventLifecycle) {
+				kind, message := lifecycle(e)
+				emit(d, kind, "", message)
+			})
+		},
+		func() (int, error) {
+			return b.conn.DomainEventDeviceAddedRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, e *libvirt.DomainEventDeviceAdded) {
+				emit(d, collector.EventDeviceAdded, e.DevAlias, "device added")
+			})
+		},
+		func() (int, error) {
+			return b.conn.DomainEventDeviceRemovedRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, e *libvirt.DomainEventDeviceRemoved) {
+				emit(d, collector.EventDeviceRemoved, e.DevAlias, "device removed")
+			})
+		},
+		func() (int, error) {
+			return b.conn.DomainEventIOErrorReasonRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, e *libvirt.DomainEventIOErrorReason) {
+				emit(d, collector.EventIOError, e.DevAlias, ioError(e))
+			})
+		},
+		func() (int, error) {
+			return b.conn.DomainEventBlockThresholdRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, e *libvirt.DomainEventBlockThreshold) {
+				emit(d, collector.EventBlockThreshold, e.Dev,
+					fmt.Sprintf("write threshold %d MiB exceeded by %d KiB", e.Threshold>>20, e.Excess>>10))
+			})
+		},
+	}
+	for _, r := range register {
+		id, err := r()
+		if err != nil {
+			b.deregister()
+			return err
+		}
+		b.callbacks = append(b.callbacks, id)
+	}
+	return nil
+}
+
+// deregister removes callbacks registered by Subscribe.
+func (b *Backend) deregister() {
+	for _, id := range b.callbacks {
+		b.conn.DomainEventDeregister(id)
+	}
+	b.callbacks = nil
+}
@@ -0,0 +1,459 @@
+// Package libvirtbackend implements collector.Backend on top of libvirt-go.
+package libvirtbackend
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/AlexZzz/virtstat/collector"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// Backend collects statistics over a libvirt connection.
+type Backend struct {
+	conn *libvirt.Connect
+	mu   sync.Mutex
+	doms map[string]*libvirt.Domain
+	// callbacks holds ids of registered event callbacks
+	callbacks []int
+}
+
+// Config describes a libvirt connection.
+type Config struct {
+	URI string
+	// ReadOnly connection is enough to collect statistics,
+	// but memory statistics period can not be set over it.
+	ReadOnly bool
+	// Auth is used for SASL authentication if set.
+	Auth *Auth
+	// Events starts libvirt event loop before connecting,
+	// it is required by Subscribe.
+	Events bool
+}
+
+// Open connects to libvirt at uri.
+func Open(uri string) (*Backend, error) {
+	return Connect(Config{URI: uri})
+}
+
+// Connect connects to libvirt as described by cfg.
+func Connect(cfg Config) (*Backend, error) {
+	if cfg.Events {
+		if err := startEventLoop(); err != nil {
+			return nil, err
+		}
+	}
+	var conn *libvirt.Connect
+	var err error
+	switch {
+	case cfg.Auth != nil:
+		var flags libvirt.ConnectFlags
+		if cfg.ReadOnly {
+			flags = libvirt.CONNECT_RO
+		}
+		conn, err = libvirt.NewConnectWithAuth(cfg.URI, cfg.Auth.connectAuth(), flags)
+	case cfg.ReadOnly:
+		conn, err = libvirt.NewConnectReadOnly(cfg.URI)
+	default:
+		conn, err = libvirt.NewConnect(cfg.URI)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{
+		conn: conn,
+		doms: make(map[string]*libvirt.Domain),
+	}, nil
+}
+
+// domain returns cached domain handle, looking it up if needed.
+func (b *Backend) domain(uuid string) (*libvirt.Domain, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d, ok := b.doms[uuid]; ok {
+		return d, nil
+	}
+	d, err := b.conn.LookupDomainByUUIDString(uuid)
+	if err != nil {
+		return nil, err
+	}
+	b.doms[uuid] = d
+	return d, nil
+}
+
+func (b *Backend) ListDomains() ([]collector.Domain, error) {
+	return b.listDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+}
+
+func (b *Backend) ListAllDomains() ([]collector.Domain, error) {
+	return b.listDomains(0)
+}
+
+/* listDomains lists domains caching their handles. Handles of
+ * domains not listed any more are freed, they are looked up again
+ * if needed, so the cache does not grow as domains come and go.
+ */
+func (b *Backend) listDomains(flags libvirt.ConnectListAllDomainsFlags) ([]collector.Domain, error) {
+	doms, err := b.conn.ListAllDomains(flags)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []collector.Domain
+	listed := make(map[string]bool, len(doms))
+	for i := range doms {
+		dom := &doms[i]
+		name, err := dom.GetName()
+		if err != nil {
+			freeDomains(doms[i:])
+			return nil, err
+		}
+		uuid, err := dom.GetUUIDString()
+		if err != nil {
+			freeDomains(doms[i:])
+			return nil, err
+		}
+		res = append(res, collector.Domain{Name: name, UUID: uuid})
+		listed[uuid] = true
+		if _, ok := b.doms[uuid]; ok {
+			dom.Free()
+			continue
+		}
+		b.doms[uuid] = dom
+	}
+	for uuid, d := range b.doms {
+		if !listed[uuid] {
+			d.Free()
+			delete(b.doms, uuid)
+		}
+	}
+	return res, nil
+}
+
+// freeDomains frees handles of doms.
+func freeDomains(doms []libvirt.Domain) {
+	for i := range doms {
+		doms[i].Free()
+	}
+}
+
+func (b *Backend) DomainXML(uuid string) (string, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return "", err
+	}
+	return d.GetXMLDesc(libvirt.DomainXMLFlags(0))
+}
+
+func (b *Backend) DomainInfo(uuid string) (collector.DomainInfo, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return collector.DomainInfo{}, err
+	}
+	info, err := d.GetInfo()
+	if err != nil {
+		return collector.DomainInfo{}, err
+	}
+	return collector.DomainInfo{
+		State:     int(info.State),
+		Vcpus:     int(info.NrVirtCpu),
+		Memory:    int64(info.Memory),
+		MaxMemory: int64(info.MaxMem),
+	}, nil
+}
+
+func (b *Backend) BlockStats(uuid, disk string) (collector.BlockStats, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return collector.BlockStats{}, err
+	}
+	// 4 is VIR_TYPED_PARAM_STRING_OKAY
+	dbs, err := d.BlockStatsFlags(disk, 4)
+	if err != nil {
+		return collector.BlockStats{}, err
+	}
+	return collector.BlockStats{
+		RdReq:           dbs.RdReq,
+		RdBytes:         dbs.RdBytes,
+		RdTotalTimes:    dbs.RdTotalTimes,
+		WrReq:           dbs.WrReq,
+		WrBytes:         dbs.WrBytes,
+		WrTotalTimes:    dbs.WrTotalTimes,
+		FlushReq:        dbs.FlushReq,
+		FlushTotalTimes: dbs.FlushTotalTimes,
+		Errs:            dbs.Errs,
+	}, nil
+}
+
+func (b *Backend) BlockInfo(uuid, disk string) (collector.BlockInfo, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return collector.BlockInfo{}, err
+	}
+	bi, err := d.GetBlockInfo(disk, 0)
+	if err != nil {
+		return collector.BlockInfo{}, err
+	}
+	return collector.BlockInfo{
+		Capacity:   int64(bi.Capacity),
+		Allocation: int64(bi.Allocation),
+		Physical:   int64(bi.Physical),
+	}, nil
+}
+
+func (b *Backend) BlockIoTune(uuid, disk string) (collector.IoTune, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return collector.IoTune{}, err
+	}
+	t, err := d.GetBlockIoTune(disk, libvirt.DOMAIN_AFFECT_LIVE)
+	if err != nil {
+		return collector.IoTune{}, err
+	}
+	return collector.IoTune{
+		TotalBytesSec:    int64(t.TotalBytesSec),
+		ReadBytesSec:     int64(t.ReadBytesSec),
+		WriteBytesSec:    int64(t.WriteBytesSec),
+		TotalIopsSec:     int64(t.TotalIopsSec),
+		ReadIopsSec:      int64(t.ReadIopsSec),
+		WriteIopsSec:     int64(t.WriteIopsSec),
+		TotalBytesSecMax: int64(t.TotalBytesSecMax),
+		ReadBytesSecMax:  int64(t.ReadBytesSecMax),
+		WriteBytesSecMax: int64(t.WriteBytesSecMax),
+		TotalIopsSecMax:  int64(t.TotalIopsSecMax),
+		ReadIopsSecMax:   int64(t.ReadIopsSecMax),
+		WriteIopsSecMax:  int64(t.WriteIopsSecMax),
+		GroupName:        t.GroupName,
+	}, nil
+}
+
+func (b *Backend) InterfaceStats(uuid, iface string) (collector.InterfaceStats, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return collector.InterfaceStats{}, err
+	}
+	dis, err := d.InterfaceStats(iface)
+	if err != nil {
+		return collector.InterfaceStats{}, err
+	}
+	return collector.InterfaceStats{
+		RxBytes:   dis.RxBytes,
+		RxPackets: dis.RxPackets,
+		RxErrs:    dis.RxErrs,
+		RxDrop:    dis.RxDrop,
+		TxBytes:   dis.TxBytes,
+		TxPackets: dis.TxPackets,
+		TxErrs:    dis.TxErrs,
+		TxDrop:    dis.TxDrop,
+	}, nil
+}
+
+func (b *Backend) CPUStats(uuid string) (collector.CPUStats, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return collector.CPUStats{}, err
+	}
+	// startCpu -1 and nCpus 1 return totals for the whole domain
+	dcs, err := d.GetCPUStats(-1, 1, 0)
+	if err != nil {
+		return collector.CPUStats{}, err
+	}
+	var cs collector.CPUStats
+	if len(dcs) > 0 {
+		cs.CPUTime = int64(dcs[0].CpuTime)
+		cs.UserTime = int64(dcs[0].UserTime)
+		cs.SystemTime = int64(dcs[0].SystemTime)
+	}
+	return cs, nil
+}
+
+// VcpuStats returns vcpus statistics using GetVcpus, which reports
+// the physical cpu.
+func (b *Backend) VcpuStats(uuid string) ([]collector.VcpuStats, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return nil, err
+	}
+	vcpus, err := d.GetVcpus()
+	if err != nil {
+		return nil, err
+	}
+	var res []collector.VcpuStats
+	for _, v := range vcpus {
+		res = append(res, collector.VcpuStats{
+			Number: int(v.Number),
+			State:  int(v.State),
+			Time:   int64(v.CpuTime),
+			CPU:    int(v.Cpu),
+		})
+	}
+	return res, nil
+}
+
+func (b *Backend) MemoryStats(uuid string) (collector.MemoryStats, error) {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return collector.MemoryStats{}, err
+	}
+	dms, err := d.MemoryStats(uint32(libvirt.DOMAIN_MEMORY_STAT_NR), 0)
+	if err != nil {
+		return collector.MemoryStats{}, err
+	}
+	var ms collector.MemoryStats
+	for _, s := range dms {
+		v := int64(s.Val)
+		switch libvirt.DomainMemoryStatTags(s.Tag) {
+		case libvirt.DOMAIN_MEMORY_STAT_SWAP_IN:
+			ms.SwapIn = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_SWAP_OUT:
+			ms.SwapOut = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_MAJOR_FAULT:
+			ms.MajorFault = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_MINOR_FAULT:
+			ms.MinorFault = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_UNUSED:
+			ms.Unused = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_AVAILABLE:
+			ms.Available = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_ACTUAL_BALLOON:
+			ms.ActualBalloon = v
+		case libvirt.DOMAIN_MEMORY_STAT_RSS:
+			ms.RSS = v
+		case libvirt.DOMAIN_MEMORY_STAT_USABLE:
+			ms.Usable = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_DISK_CACHES:
+			ms.DiskCaches = v
+			ms.GuestReported = true
+		case libvirt.DOMAIN_MEMORY_STAT_LAST_UPDATE:
+			ms.LastUpdate = v
+		}
+	}
+	return ms, nil
+}
+
+func (b *Backend) SetMemoryStatsPeriod(uuid string, period int) error {
+	d, err := b.domain(uuid)
+	if err != nil {
+		return err
+	}
+	return d.SetMemoryStatsPeriod(period, libvirt.DOMAIN_MEM_LIVE)
+}
+
+// statsTypes returns libvirt stats types of groups.
+func statsTypes(groups collector.StatsGroup) libvirt.DomainStatsTypes {
+	var types libvirt.DomainStatsTypes
+	if groups&collector.StatsBlock != 0 {
+		types |= libvirt.DOMAIN_STATS_BLOCK
+	}
+	if groups&collector.StatsInterface != 0 {
+		types |= libvirt.DOMAIN_STATS_INTERFACE
+	}
+	return types
+}
+
+// AllDomainStats returns statistics groups of domains with given
+// uuids using a single GetAllDomainStats call.
+func (b *Backend) AllDomainStats(uuids []string, groups collector.StatsGroup) ([]collector.DomainStats, error) {
+	return b.allDomainStats(uuids, statsTypes(groups), 0)
+}
+
+// AllDomainStatsBacking is AllDomainStats of block statistics
+// reporting every backing chain layer of disks as well.
+func (b *Backend) AllDomainStatsBacking(uuids []string) ([]collector.DomainStats, error) {
+	return b.allDomainStats(uuids, statsTypes(collector.StatsBlock), libvirt.CONNECT_GET_ALL_DOMAINS_STATS_BACKING)
+}
+
+func (b *Backend) allDomainStats(uuids []string, types libvirt.DomainStatsTypes, flags libvirt.ConnectGetAllDomainStatsFlags) ([]collector.DomainStats, error) {
+	var doms []*libvirt.Domain
+	for _, uuid := range uuids {
+		d, err := b.domain(uuid)
+		if err != nil {
+			return nil, err
+		}
+		doms = append(doms, d)
+	}
+	if len(doms) == 0 {
+		return nil, nil
+	}
+	stats, err := b.conn.GetAllDomainStats(doms, types, flags)
+	if err != nil {
+		return nil, err
+	}
+	var res []collector.DomainStats
+	for _, s := range stats {
+		uuid, err := s.Domain.GetUUIDString()
+		s.Domain.Free()
+		if err != nil {
+			return nil, err
+		}
+		ds := collector.DomainStats{
+			UUID:      uuid,
+			Block:     make(map[string]collector.BlockStats),
+			BlockInfo: make(map[string]collector.BlockInfo),
+			Interface: make(map[string]collector.InterfaceStats),
+		}
+		for _, bs := range s.Block {
+			/* Layers of a disk follow its top image,
+			 * which is the first one reported
+			 */
+			name := bs.Name
+			if _, ok := ds.Block[name]; ok && bs.BackingIndexSet {
+				name = fmt.Sprintf("%s[%d]", bs.Name, bs.BackingIndex)
+			}
+			ds.Block[name] = collector.BlockStats{
+				RdReq:           int64(bs.RdReqs),
+				RdBytes:         int64(bs.RdBytes),
+				RdTotalTimes:    int64(bs.RdTimes),
+				WrReq:           int64(bs.WrReqs),
+				WrBytes:         int64(bs.WrBytes),
+				WrTotalTimes:    int64(bs.WrTimes),
+				FlushReq:        int64(bs.FlReqs),
+				FlushTotalTimes: int64(bs.FlTimes),
+				Errs:            int64(bs.Errors),
+			}
+			// Sizes are reported only if known, GetBlockInfo is used otherwise
+			if bs.CapacitySet && bs.AllocationSet && bs.PhysicalSet {
+				ds.BlockInfo[name] = collector.BlockInfo{
+					Capacity:   int64(bs.Capacity),
+					Allocation: int64(bs.Allocation),
+					Physical:   int64(bs.Physical),
+				}
+			}
+		}
+		for _, ns := range s.Net {
+			ds.Interface[ns.Name] = collector.InterfaceStats{
+				RxBytes:   int64(ns.RxBytes),
+				RxPackets: int64(ns.RxPkts),
+				RxErrs:    int64(ns.RxErrs),
+				RxDrop:    int64(ns.RxDrop),
+				TxBytes:   int64(ns.TxBytes),
+				TxPackets: int64(ns.TxPkts),
+				TxErrs:    int64(ns.TxErrs),
+				TxDrop:    int64(ns.TxDrop),
+			}
+		}
+		res = append(res, ds)
+	}
+	return res, nil
+}
+
+// Close frees domain handles and closes the connection.
+func (b *Backend) Close() error {
+	b.deregister()
+	b.mu.Lock()
+	for uuid, d := range b.doms {
+		d.Free()
+		delete(b.doms, uuid)
+	}
+	b.mu.Unlock()
+	_, err := b.conn.Close()
+	return err
+}
@@ -0,0 +1,45 @@
+package output
+
+import (
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// LayerRecords converts backing chain layer deltas to records of rates
+// and allocation of every layer, device is the layer name like "vda[1]".
+func LayerRecords(deltas []collector.LayerDelta) []Record {
+	var records []Record
+	for _, d := range deltas {
+		start := len(records)
+		r := d.Rates()
+		var format interface{}
+		if d.Layer.Format != "" {
+			format = d.Layer.Format
+		}
+		records = append(records, Record{
+			Time:     d.Time,
+			Domain:   d.Domain,
+			UUID:     d.UUID,
+			Device:   d.Layer.Name,
+			Family:   "layer",
+			Tags:     diskTags(d.Layer.Disk),
+			Counters: blockCounters(d.Total),
+			Fields: []Field{
+				{"depth", int64(d.Layer.Depth)},
+				{"format", format},
+				{"r/s", r.RdReq},
+				{"w/s", r.WrReq},
+				{"rkB/s", r.RdKB},
+				{"wkB/s", r.WrKB},
+				{"r_await", r.RdAwait},
+				{"w_await", r.WrAwait},
+				{"alloc_MB", r.Allocation},
+				{"grow_kB/s", r.Growth},
+				{"path", d.Layer.Path},
+			},
+		})
+		if d.Reset {
+			markReset(records[start:], "alloc_MB")
+		}
+	}
+	return records
+}
@@ -0,0 +1,43 @@
+package output
+
+import (
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// CapacityRecords converts capacity deltas to records of disk sizes,
+// allocation growth and estimated time until a disk is full.
+// The estimate is unknown while allocation does not grow.
+func CapacityRecords(deltas []collector.CapacityDelta) []Record {
+	var records []Record
+	for _, d := range deltas {
+		r := d.Rates()
+		var full interface{}
+		if r.TimeToFull >= 0 {
+			full = r.TimeToFull.Round(time.Second).String()
+		}
+		records = append(records, Record{
+			Time:   d.Time,
+			Domain: d.Domain,
+			UUID:   d.UUID,
+			Device: d.Disk.Target.DiskName,
+			Family: "capacity",
+			Tags:   diskTags(d.Disk),
+			Counters: []Field{
+				{"capacity", d.Info.Capacity},
+				{"allocation", d.Info.Allocation},
+				{"physical", d.Info.Physical},
+			},
+			Fields: []Field{
+				{"cap_MB", r.Capacity},
+				{"alloc_MB", r.Allocation},
+				{"phys_MB", r.Physical},
+				{"%used", r.Used},
+				{"grow_kB/s", r.Growth},
+				{"full_in", full},
+			},
+		})
+	}
+	return records
+}
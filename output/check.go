@@ -0,0 +1,214 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Monitoring plugin states, the exit codes of a check.
+const (
+	StateOK = iota
+	StateWarning
+	StateCritical
+	StateUnknown
+)
+
+// StateNames holds names of states as shown by monitoring plugins.
+var StateNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// severity orders states, a limit crossed is worse than
+// a value unknown.
+var severity = []int{StateOK: 0, StateUnknown: 1, StateWarning: 2, StateCritical: 3}
+
+var thresholdRe = regexp.MustCompile(`^\s*([^<>=\s]+)\s*(>=|<=|>|<)\s*(\S+)\s*$`)
+
+// Threshold is a limit of a column, like "w_await>50ms".
+type Threshold struct {
+	Column string
+	Op     string
+	Value  float64
+	// text is the limit as given
+	text string
+}
+
+/* ParseThreshold parses s of the form column, operator, one of >, >=,
+ * < or <=, and a number. A number may end with %, durations like 50ms
+ * are converted to milliseconds, the unit of await columns.
+ */
+func ParseThreshold(s string) (Threshold, error) {
+	m := thresholdRe.FindStringSubmatch(s)
+	if m == nil {
+		return Threshold{}, fmt.Errorf("%s: threshold is not like 'column>number'", s)
+	}
+	t := Threshold{Column: m[1], Op: m[2], text: m[3]}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(m[3], "%"), 64)
+	if err != nil {
+		d, derr := time.ParseDuration(m[3])
+		if derr != nil {
+			return Threshold{}, fmt.Errorf("%s: %s is neither a number nor a duration", s, m[3])
+		}
+		v = float64(d) / float64(time.Millisecond)
+	}
+	t.Value = v
+	return t, nil
+}
+
+// exceeded reports whether v is beyond t.
+func (t Threshold) exceeded(v float64) bool {
+	switch t.Op {
+	case ">":
+		return v > t.Value
+	case ">=":
+		return v >= t.Value
+	case "<":
+		return v < t.Value
+	}
+	return v <= t.Value
+}
+
+/* perfRange returns t as a plugin range, which alerts outside of
+ * it, or inside of it if it starts with @, bounds included.
+ */
+func (t Threshold) perfRange() string {
+	v := strconv.FormatFloat(t.Value, 'f', -1, 64)
+	switch t.Op {
+	case ">":
+		return "~:" + v
+	case ">=":
+		return "@" + v + ":"
+	case "<":
+		return v + ":"
+	}
+	return "@~:" + v
+}
+
+// numeric returns v as float64, ok is false if v is not a number.
+func numeric(v interface{}) (f float64, ok bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+/* Check compares fields of records with thresholds, crit ones are
+ * checked first. It returns the worst state and a problem per device
+ * and column beyond a threshold. A value unknown, say after counters
+ * reset, is UNKNOWN unless another one is beyond a threshold. An error
+ * is returned if a threshold names a column no record has.
+ */
+func Check(records []Record, warn, crit []Threshold) (state int, problems []string, err error) {
+	found := make(map[string]bool)
+	for _, r := range records {
+		for _, field := range r.Fields {
+			found[field.Name] = true
+		}
+	}
+	for _, t := range append(append([]Threshold{}, crit...), warn...) {
+		if !found[t.Column] {
+			return StateUnknown, nil, fmt.Errorf("%s: no such column", t.Column)
+		}
+	}
+	raise := func(s int, problem string) {
+		if severity[s] > severity[state] {
+			state = s
+		}
+		problems = append(problems, problem)
+	}
+	for _, r := range records {
+		for _, field := range r.Fields {
+			s, problem := checkField(r.Device, field, warn, crit)
+			if s != StateOK {
+				raise(s, problem)
+			}
+		}
+	}
+	return state, problems, nil
+}
+
+// checkField returns state of field of device.
+func checkField(device string, field Field, warn, crit []Threshold) (int, string) {
+	levels := []struct {
+		state      int
+		thresholds []Threshold
+	}{
+		{StateCritical, crit},
+		{StateWarning, warn},
+	}
+	for _, l := range levels {
+		for _, t := range l.thresholds {
+			if t.Column != field.Name {
+				continue
+			}
+			v, ok := numeric(field.Value)
+			if !ok {
+				return StateUnknown, fmt.Sprintf("%s %s is unknown", device, field.Name)
+			}
+			if t.exceeded(v) {
+				return l.state, fmt.Sprintf("%s %s %s %s %s", device, field.Name,
+					strconv.FormatFloat(v, 'f', 2, 64), t.Op, t.text)
+			}
+		}
+	}
+	return StateOK, ""
+}
+
+// perfUnit returns unit of measure of column name.
+func perfUnit(name string) string {
+	switch {
+	case strings.HasSuffix(name, "await"):
+		return "ms"
+	case strings.HasPrefix(name, "%"):
+		return "%"
+	}
+	return ""
+}
+
+// perfThreshold returns range of the first threshold of column name.
+func perfThreshold(name string, thresholds []Threshold) string {
+	for _, t := range thresholds {
+		if t.Column == name {
+			return t.perfRange()
+		}
+	}
+	return ""
+}
+
+/* WritePlugin writes monitoring plugin output of a check of service,
+ * "SERVICE STATE - text | perfdata", performance data is every number
+ * of records labelled with the device and the column, unknown ones
+ * are U.
+ */
+func WritePlugin(w io.Writer, service string, state int, text string, records []Record, warn, crit []Threshold) error {
+	var perf []string
+	for _, r := range records {
+		for _, field := range r.Fields {
+			var value string
+			switch v := field.Value.(type) {
+			case nil:
+				value = "U"
+			case int64, float64:
+				f, _ := numeric(v)
+				value = strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64) + perfUnit(field.Name)
+			default:
+				continue
+			}
+			label := strings.Replace(r.Device+" "+field.Name, "'", "''", -1)
+			perf = append(perf, fmt.Sprintf("'%s'=%s;%s;%s", label, value,
+				perfThreshold(field.Name, warn), perfThreshold(field.Name, crit)))
+		}
+	}
+	line := fmt.Sprintf("%s %s - %s", strings.ToUpper(service), StateNames[state], text)
+	if len(perf) > 0 {
+		line += " | " + strings.Join(perf, " ")
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
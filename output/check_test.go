@@ -0,0 +1,96 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		s      string
+		column string
+		op     string
+		value  float64
+	}{
+		{"w_await>50ms", "w_await", ">", 50},
+		{"r_await >= 1.5s", "r_await", ">=", 1500},
+		{"err/s>0", "err/s", ">", 0},
+		{"%iops<=90%", "%iops", "<=", 90},
+	}
+	for _, tt := range tests {
+		th, err := ParseThreshold(tt.s)
+		if err != nil {
+			t.Errorf("%s: %v", tt.s, err)
+			continue
+		}
+		if th.Column != tt.column || th.Op != tt.op || th.Value != tt.value {
+			t.Errorf("%s: got %+v", tt.s, th)
+		}
+	}
+	for _, s := range []string{"w_await", "w_await>fast", ">5"} {
+		if _, err := ParseThreshold(s); err == nil {
+			t.Errorf("%s: no error", s)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	parse := func(s string) []Threshold {
+		th, err := ParseThreshold(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []Threshold{th}
+	}
+	records := []Record{
+		{Device: "vda", Fields: []Field{{"w_await", 72.5}, {"err/s", 0.0}, {"group", "fast"}}},
+		{Device: "vdb", Fields: []Field{{"w_await", 12.0}, {"err/s", nil}}},
+	}
+	tests := []struct {
+		warn, crit string
+		state      int
+		problems   int
+	}{
+		{"w_await>10ms", "w_await>50ms", StateCritical, 2},
+		{"w_await>100", "w_await>200", StateOK, 0},
+		{"err/s>0", "w_await>200", StateUnknown, 1},
+		{"err/s>0", "w_await>50", StateCritical, 2},
+	}
+	for _, tt := range tests {
+		state, problems, err := Check(records, parse(tt.warn), parse(tt.crit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != tt.state || len(problems) != tt.problems {
+			t.Errorf("%s %s: got %s %q", tt.warn, tt.crit, StateNames[state], problems)
+		}
+	}
+	if _, _, err := Check(records, parse("r/s>1"), nil); err == nil {
+		t.Errorf("unknown column: no error")
+	}
+
+	var buf bytes.Buffer
+	WritePlugin(&buf, "disk", StateCritical, "web: vda w_await 72.50 > 50ms", records[:1], nil, parse("w_await>50ms"))
+	want := "DISK CRITICAL - web: vda w_await 72.50 > 50ms | 'vda w_await'=72.5ms;;~:50 'vda err/s'=0;;\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPerfRange(t *testing.T) {
+	tests := map[string]string{
+		"err/s>0":   "~:0",
+		"err/s>=1":  "@1:",
+		"%iops<10":  "10:",
+		"%iops<=10": "@~:10",
+	}
+	for s, want := range tests {
+		th, err := ParseThreshold(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := th.perfRange(); got != want {
+			t.Errorf("%s: got %q, want %q", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package output
+
+import (
+	"fmt"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// CPURecords converts cpu deltas to records of cpu usage over the measured
+// interval. Every domain gets a "cpu" record followed by a record per vcpu.
+func CPURecords(deltas []collector.CPUDelta) []Record {
+	var records []Record
+	for _, d := range deltas {
+		start := len(records)
+		r := d.Rates()
+		records = append(records, Record{
+			Time:   d.Time,
+			Domain: d.Domain,
+			UUID:   d.UUID,
+			Device: "cpu",
+			Family: "cpu",
+			Counters: []Field{
+				{"cpu_time", d.Total.CPUTime},
+				{"user_time", d.Total.UserTime},
+				{"system_time", d.Total.SystemTime},
+			},
+			Fields: []Field{
+				{"%cpu", r.CPU},
+				{"%user", r.User},
+				{"%system", r.System},
+			},
+		})
+		for _, v := range r.Vcpus {
+			var pcpu interface{}
+			if v.CPU >= 0 {
+				pcpu = int64(v.CPU)
+			}
+			records = append(records, Record{
+				Time:   d.Time,
+				Domain: d.Domain,
+				UUID:   d.UUID,
+				Device: fmt.Sprintf("vcpu%d", v.Number),
+				Family: "cpu",
+				Fields: []Field{
+					{"%vcpu", v.Usage},
+					{"pcpu", pcpu},
+					{"state", v.State},
+				},
+			})
+		}
+		if d.Reset {
+			markReset(records[start:])
+		}
+	}
+	return records
+}
@@ -0,0 +1,101 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+)
+
+// csvFormatter writes delimiter separated values with a single header.
+// Header holds the columns given, or every column of the first interval
+// records if none are, followed by the event one. Rows lacking a column
+// have it empty.
+type csvFormatter struct {
+	w       *csv.Writer
+	columns []string
+	// host is set if records are tagged with host
+	host bool
+	// header is set once the header is written
+	header bool
+}
+
+func newCSVFormatter(w io.Writer, comma rune) *csvFormatter {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	return &csvFormatter{w: cw}
+}
+
+/* NewCSV returns a formatter of values separated by comma with
+ * a header of columns, led by a host one if host is set. The header
+ * is written before the first records whatever fields they hold.
+ */
+func NewCSV(w io.Writer, comma rune, columns []string, host bool) Formatter {
+	f := newCSVFormatter(w, comma)
+	f.columns = columns
+	f.host = host
+	return f
+}
+
+// Columns returns names of fields of records in order of appearance.
+func Columns(records []Record) []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, r := range records {
+		for _, field := range r.Fields {
+			if !seen[field.Name] {
+				seen[field.Name] = true
+				columns = append(columns, field.Name)
+			}
+		}
+	}
+	return columns
+}
+
+func (f *csvFormatter) writeHeader(records []Record) error {
+	if f.columns == nil {
+		for _, r := range records {
+			if r.Host != "" {
+				f.host = true
+			}
+		}
+		f.columns = Columns(records)
+	}
+	row := []string{"domain", "uuid", "device", "timestamp"}
+	if f.host {
+		row = append([]string{"host"}, row...)
+	}
+	row = append(row, f.columns...)
+	// Events may come any time later, the column is always there
+	return f.w.Write(append(row, "event"))
+}
+
+func (f *csvFormatter) Write(t time.Time, records []Record) error {
+	if !f.header && len(records) > 0 {
+		f.header = true
+		if err := f.writeHeader(records); err != nil {
+			return err
+		}
+	}
+	for _, r := range records {
+		values := make(map[string]string, len(r.Fields))
+		for _, field := range r.Fields {
+			if field.Value != nil {
+				values[field.Name] = fmt.Sprint(field.Value)
+			}
+		}
+		row := []string{r.Domain, r.UUID, r.Device, r.Time.Format(timestampLayout)}
+		if f.host {
+			row = append([]string{r.Host}, row...)
+		}
+		for _, c := range f.columns {
+			row = append(row, values[c])
+		}
+		row = append(row, r.Event)
+		if err := f.w.Write(row); err != nil {
+			return err
+		}
+	}
+	f.w.Flush()
+	return f.w.Error()
+}
@@ -0,0 +1,150 @@
+package output
+
+import (
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// diskTags returns serial and bus of d.
+func diskTags(d collector.Disk) []Field {
+	return []Field{
+		{"serial", d.Serial},
+		{"bus", d.Target.DiskBus},
+	}
+}
+
+// blockCounters returns raw counters of a disk.
+func blockCounters(s collector.BlockStats) []Field {
+	return []Field{
+		{"rd_req", s.RdReq},
+		{"rd_bytes", s.RdBytes},
+		{"rd_total_times", s.RdTotalTimes},
+		{"wr_req", s.WrReq},
+		{"wr_bytes", s.WrBytes},
+		{"wr_total_times", s.WrTotalTimes},
+		{"flush_req", s.FlushReq},
+		{"flush_total_times", s.FlushTotalTimes},
+		{"errs", s.Errs},
+	}
+}
+
+// DiskRecords converts disk deltas to records of per second rates
+// over the measured interval.
+func DiskRecords(deltas []collector.Delta) []Record {
+	var records []Record
+	for _, d := range deltas {
+		start := len(records)
+		r := d.Rates()
+		records = append(records, Record{
+			Time:     d.Time,
+			Domain:   d.Domain,
+			UUID:     d.UUID,
+			Device:   d.Disk.Target.DiskName,
+			Family:   "disk",
+			Tags:     diskTags(d.Disk),
+			Counters: blockCounters(d.Total),
+			Fields: []Field{
+				{"r/s", r.RdReq},
+				{"w/s", r.WrReq},
+				{"flush/s", r.FlushReq},
+				{"rkB/s", r.RdKB},
+				{"wkB/s", r.WrKB},
+				{"r_await", r.RdAwait},
+				{"w_await", r.WrAwait},
+				{"flush_await", r.FlushAwait},
+				{"err/s", r.Errs},
+			},
+		})
+		if d.Reset {
+			markReset(records[start:])
+		}
+	}
+	return records
+}
+
+// ThrottleDiskRecords converts disk deltas to records of rates and
+// their percentage of the disk I/O limits over the measured interval.
+// Percentages of unset limits are unknown.
+func ThrottleDiskRecords(deltas []collector.Delta) []Record {
+	var records []Record
+	pct := func(v float64) interface{} {
+		if v < 0 {
+			return nil
+		}
+		return v
+	}
+	for _, d := range deltas {
+		start := len(records)
+		r := d.ThrottleRates()
+		var group interface{}
+		if r.Group != "" {
+			group = r.Group
+		}
+		records = append(records, Record{
+			Time:     d.Time,
+			Domain:   d.Domain,
+			UUID:     d.UUID,
+			Device:   d.Disk.Target.DiskName,
+			Family:   "disk",
+			Tags:     diskTags(d.Disk),
+			Counters: blockCounters(d.Total),
+			Fields: []Field{
+				{"group", group},
+				{"r/s", r.RdReq},
+				{"w/s", r.WrReq},
+				{"rkB/s", r.RdKB},
+				{"wkB/s", r.WrKB},
+				{"%iops", pct(r.IOPS)},
+				{"%r_iops", pct(r.ReadIOPS)},
+				{"%w_iops", pct(r.WriteIOPS)},
+				{"%bw", pct(r.BW)},
+				{"%r_bw", pct(r.ReadBW)},
+				{"%w_bw", pct(r.WriteBW)},
+				{"%iops_max", pct(r.IOPSMax)},
+				{"%bw_max", pct(r.BWMax)},
+				{"capped", r.Capped},
+			},
+		})
+		if d.Reset {
+			markReset(records[start:])
+		}
+	}
+	return records
+}
+
+// ExtendedDiskRecords converts disk deltas to records of iostat -x
+// like metrics over the measured interval.
+func ExtendedDiskRecords(deltas []collector.Delta) []Record {
+	var records []Record
+	for _, d := range deltas {
+		start := len(records)
+		r := d.ExtendedRates()
+		records = append(records, Record{
+			Time:     d.Time,
+			Domain:   d.Domain,
+			UUID:     d.UUID,
+			Device:   d.Disk.Target.DiskName,
+			Family:   "disk",
+			Tags:     diskTags(d.Disk),
+			Counters: blockCounters(d.Total),
+			Fields: []Field{
+				{"r/s", r.RdReq},
+				{"rkB/s", r.RdKB},
+				{"r_await", r.RdAwait},
+				{"rareq-sz", r.RdReqSize},
+				{"w/s", r.WrReq},
+				{"wkB/s", r.WrKB},
+				{"w_await", r.WrAwait},
+				{"wareq-sz", r.WrReqSize},
+				{"f/s", r.FlushReq},
+				{"f_await", r.FlushAwait},
+				{"await", r.Await},
+				{"aqu-sz", r.QueueSize},
+				{"err/s", r.Errs},
+			},
+		})
+		if d.Reset {
+			markReset(records[start:])
+		}
+	}
+	return records
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTemplate is the metric path template used by default.
+const DefaultTemplate = "virtstat.{host}.{domain}.{device}.{metric}"
+
+var (
+	placeholderRe = regexp.MustCompile(`\{([a-z]+)\}`)
+	// invalidPathRe matches characters not allowed in a path component
+	invalidPathRe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+)
+
+// placeholders lists names of template placeholders.
+var placeholders = []string{"host", "domain", "uuid", "device", "family", "metric"}
+
+// graphiteFormatter writes a rate per line, Carbon plaintext
+// "path value timestamp" or a StatsD gauge "path:value|g".
+type graphiteFormatter struct {
+	w        io.Writer
+	template []string
+	statsd   bool
+}
+
+/* NewGraphite returns a formatter of rates as Carbon plaintext, or as
+ * StatsD gauges if statsd is set. Metric paths are made of template,
+ * like "virt.{host}.{domain}.{device}.{metric}", placeholders are
+ * replaced with sanitized record values and components left empty
+ * are dropped. The metric is appended if template has none.
+ */
+func NewGraphite(w io.Writer, template string, statsd bool) (Formatter, error) {
+	hasMetric := false
+	for _, m := range placeholderRe.FindAllStringSubmatch(template, -1) {
+		known := false
+		for _, p := range placeholders {
+			if m[1] == p {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: unknown placeholder, use %s", m[0], strings.Join(placeholders, ", "))
+		}
+		if m[1] == "metric" {
+			hasMetric = true
+		}
+	}
+	if !hasMetric {
+		template += ".{metric}"
+	}
+	return &graphiteFormatter{
+		w:        w,
+		template: strings.Split(template, "."),
+		statsd:   statsd,
+	}, nil
+}
+
+// sanitize turns s into a valid path component.
+func sanitize(s string) string {
+	return invalidPathRe.ReplaceAllString(s, "_")
+}
+
+// path returns metric path of field name of r.
+func (f *graphiteFormatter) path(r Record, name string) string {
+	values := map[string]string{
+		"host":   r.Host,
+		"domain": r.Domain,
+		"uuid":   r.UUID,
+		"device": r.Device,
+		"family": r.Family,
+		"metric": metricName(name),
+	}
+	var path []string
+	for _, c := range f.template {
+		c = placeholderRe.ReplaceAllStringFunc(c, func(p string) string {
+			return sanitize(values[p[1:len(p)-1]])
+		})
+		if c != "" {
+			path = append(path, c)
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+// graphiteValue formats a numeric value, ok is false for others.
+func graphiteValue(v interface{}) (s string, ok bool) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	}
+	return "", false
+}
+
+func (f *graphiteFormatter) Write(t time.Time, records []Record) error {
+	var buf bytes.Buffer
+	for _, r := range records {
+		for _, field := range r.Fields {
+			v, ok := graphiteValue(field.Value)
+			if !ok {
+				continue
+			}
+			path := f.path(r, field.Name)
+			switch {
+			case f.statsd && strings.HasPrefix(v, "-"):
+				// A signed gauge changes the value, it is reset first
+				fmt.Fprintf(&buf, "%s:0|g\n%s:%s|g\n", path, path, v)
+			case f.statsd:
+				fmt.Fprintf(&buf, "%s:%s|g\n", path, v)
+			default:
+				fmt.Fprintf(&buf, "%s %s %d\n", path, v, r.Time.Unix())
+			}
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := f.w.Write(buf.Bytes())
+	return err
+}
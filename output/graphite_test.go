@@ -0,0 +1,60 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestGraphite(t *testing.T) {
+	r := Record{
+		Time:   time.Unix(1540000000, 0),
+		Host:   "kvm-01.example.com",
+		Domain: "web.example.com",
+		UUID:   "u-1",
+		Device: "vda",
+		Family: "disk",
+		Fields: []Field{
+			{"r/s", 1.5},
+			{"%used", int64(40)},
+			{"grow_kB/s", -2.0},
+			{"group", "fast"},
+			{"full_in", nil},
+		},
+	}
+	tests := []struct {
+		template string
+		statsd   bool
+		host     string
+		want     string
+	}{
+		{"virt.{host}.{domain}.{device}", false, r.Host,
+			"virt.kvm-01_example_com.web_example_com.vda.r_per_s 1.5 1540000000\n" +
+				"virt.kvm-01_example_com.web_example_com.vda.pct_used 40 1540000000\n" +
+				"virt.kvm-01_example_com.web_example_com.vda.grow_kB_per_s -2 1540000000\n"},
+		// Empty host is dropped
+		{"virt.{host}.{family}_{device}.{metric}.avg", true, "",
+			"virt.disk_vda.r_per_s.avg:1.5|g\n" +
+				"virt.disk_vda.pct_used.avg:40|g\n" +
+				"virt.disk_vda.grow_kB_per_s.avg:0|g\n" +
+				"virt.disk_vda.grow_kB_per_s.avg:-2|g\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		f, err := NewGraphite(&buf, tt.template, tt.statsd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := r
+		rec.Host = tt.host
+		if err := f.Write(r.Time, []Record{rec}); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s:\ngot\n%swant\n%s", tt.template, buf.String(), tt.want)
+		}
+	}
+	if _, err := NewGraphite(new(bytes.Buffer), "virt.{vm}", false); err == nil {
+		t.Errorf("unknown placeholder: no error")
+	}
+}
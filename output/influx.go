@@ -0,0 +1,95 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxFormatter writes InfluxDB line protocol, a line per record.
+// Measurement is virtstat_ followed by the record family, the device
+// and domain are tags, rates and raw counters are fields.
+type influxFormatter struct {
+	w io.Writer
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxStringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxValue formats v as a field value, ok is false if v is unknown.
+func influxValue(v interface{}) (s string, ok bool) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return `"` + influxStringEscaper.Replace(v) + `"`, true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// writeLine writes r as a line, records without known fields
+// are skipped.
+func writeLine(buf *bytes.Buffer, r Record) {
+	family := r.Family
+	if family == "" {
+		family = "stats"
+	}
+	tags := []Field{
+		{"host", r.Host},
+		{"domain", r.Domain},
+		{"uuid", r.UUID},
+		{"device", r.Device},
+	}
+	var line bytes.Buffer
+	line.WriteString(influxMeasurementEscaper.Replace("virtstat_" + family))
+	for _, t := range append(tags, r.Tags...) {
+		// Empty tag values are not allowed
+		if v, ok := t.Value.(string); ok && v != "" {
+			line.WriteString("," + influxKeyEscaper.Replace(t.Name) + "=" + influxKeyEscaper.Replace(v))
+		}
+	}
+	fields := append(append([]Field{}, r.Fields...), r.Counters...)
+	if r.Event != "" {
+		fields = append(fields, Field{"event", r.Event})
+	}
+	n := 0
+	for _, f := range fields {
+		v, ok := influxValue(f.Value)
+		if !ok {
+			continue
+		}
+		if n == 0 {
+			line.WriteString(" ")
+		} else {
+			line.WriteString(",")
+		}
+		line.WriteString(influxKeyEscaper.Replace(metricName(f.Name)) + "=" + v)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	line.WriteString(" " + strconv.FormatInt(r.Time.UnixNano(), 10) + "\n")
+	buf.Write(line.Bytes())
+}
+
+func (f *influxFormatter) Write(t time.Time, records []Record) error {
+	var buf bytes.Buffer
+	for _, r := range records {
+		writeLine(&buf, r)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := f.w.Write(buf.Bytes())
+	return err
+}
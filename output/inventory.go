@@ -0,0 +1,166 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// Inventory is a domain description, Host is set when several
+// hypervisors are listed.
+type Inventory struct {
+	Host string
+	collector.DomainInventory
+}
+
+// InventoryFormats lists supported inventory output formats.
+var InventoryFormats = []string{"table", "json"}
+
+type diskJSON struct {
+	Target   string `json:"target"`
+	Bus      string `json:"bus,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	Driver   string `json:"driver_type,omitempty"`
+	Cache    string `json:"cache,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Pool     string `json:"pool,omitempty"`
+	Volume   string `json:"volume,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+type interfaceJSON struct {
+	Target  string `json:"target"`
+	Type    string `json:"type,omitempty"`
+	MAC     string `json:"mac,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Bridge  string `json:"bridge,omitempty"`
+	Network string `json:"network,omitempty"`
+	Dev     string `json:"source_dev,omitempty"`
+}
+
+type domainJSON struct {
+	Host       string          `json:"host,omitempty"`
+	Name       string          `json:"name"`
+	UUID       string          `json:"uuid"`
+	State      string          `json:"state"`
+	Vcpus      int             `json:"vcpus"`
+	Memory     int64           `json:"memory_kib"`
+	MaxMemory  int64           `json:"max_memory_kib"`
+	Disks      []diskJSON      `json:"disks"`
+	Interfaces []interfaceJSON `json:"interfaces"`
+}
+
+func writeInventoryJSON(w io.Writer, inv []Inventory) error {
+	doms := make([]domainJSON, 0, len(inv))
+	for _, i := range inv {
+		d := domainJSON{
+			Host:       i.Host,
+			Name:       i.Name,
+			UUID:       i.UUID,
+			State:      i.Info.StateName(),
+			Vcpus:      i.Info.Vcpus,
+			Memory:     i.Info.Memory,
+			MaxMemory:  i.Info.MaxMemory,
+			Disks:      []diskJSON{},
+			Interfaces: []interfaceJSON{},
+		}
+		for _, v := range i.Disks {
+			d.Disks = append(d.Disks, diskJSON{
+				Target:   v.Target.DiskName,
+				Bus:      v.Target.DiskBus,
+				Device:   v.Device,
+				Type:     v.Type,
+				Serial:   v.Serial,
+				Driver:   v.Driver.Type,
+				Cache:    v.Driver.Cache,
+				Source:   v.Source.Path(),
+				Pool:     v.Source.Pool,
+				Volume:   v.Source.Volume,
+				Protocol: v.Source.Protocol,
+			})
+		}
+		for _, v := range i.Interfaces {
+			d.Interfaces = append(d.Interfaces, interfaceJSON{
+				Target:  v.Target.Dev,
+				Type:    v.Type,
+				MAC:     v.MAC.Address,
+				Model:   v.Model.Type,
+				Bridge:  v.Source.Bridge,
+				Network: v.Source.Network,
+				Dev:     v.Source.Dev,
+			})
+		}
+		doms = append(doms, d)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doms)
+}
+
+// dash returns s, or "-" if s is empty.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func writeInventoryTable(w io.Writer, inv []Inventory) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for n, i := range inv {
+		if n > 0 {
+			fmt.Fprintf(tw, "\n")
+		}
+		fmt.Fprintf(tw, "Domain: %s (%s)", i.Name, i.UUID)
+		if i.Host != "" {
+			fmt.Fprintf(tw, " on %s", i.Host)
+		}
+		fmt.Fprintf(tw, ": %s, %d vcpus, %d MiB memory\n",
+			i.Info.StateName(), i.Info.Vcpus, i.Info.Memory/1024)
+		if len(i.Disks) > 0 {
+			fmt.Fprintf(tw, "Disk\tBus\tDevice\tType\tDriver\tCache\tSerial\tSource\n")
+		}
+		for _, v := range i.Disks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				v.Target.DiskName, dash(v.Target.DiskBus), dash(v.Device),
+				dash(v.Type), dash(v.Driver.Type), dash(v.Driver.Cache),
+				dash(v.Serial), dash(v.Source.Path()))
+		}
+		if len(i.Interfaces) > 0 {
+			fmt.Fprintf(tw, "Interface\tType\tMAC\tModel\tSource\n")
+		}
+		for _, v := range i.Interfaces {
+			source := v.Source.Bridge
+			if source == "" {
+				source = v.Source.Network
+			}
+			if source == "" {
+				source = v.Source.Dev
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				dash(v.Target.Dev), dash(v.Type), dash(v.MAC.Address),
+				dash(v.Model.Type), dash(source))
+		}
+		// Columns of every domain are aligned separately
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteInventory writes domains descriptions in the given format.
+func WriteInventory(w io.Writer, format string, inv []Inventory) error {
+	switch format {
+	case "table":
+		return writeInventoryTable(w, inv)
+	case "json":
+		return writeInventoryJSON(w, inv)
+	}
+	return fmt.Errorf("%s: unknown output format", format)
+}
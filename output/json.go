@@ -0,0 +1,76 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonFormatter writes one JSON document per interval, or
+// one JSON object per device per interval if perDevice is set.
+type jsonFormatter struct {
+	w         io.Writer
+	perDevice bool
+}
+
+// writeObject encodes r as a JSON object keeping fields order.
+func writeObject(buf *bytes.Buffer, r Record) error {
+	buf.WriteString("{")
+	var keys []Field
+	if r.Host != "" {
+		keys = append(keys, Field{"host", r.Host})
+	}
+	keys = append(keys, []Field{
+		{"domain", r.Domain},
+		{"uuid", r.UUID},
+		{"device", r.Device},
+		{"timestamp", r.Time.Format(timestampLayout)},
+	}...)
+	if r.Event != "" {
+		keys = append(keys, Field{"event", r.Event})
+	}
+	for i, field := range append(keys, r.Fields...) {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		k, err := json.Marshal(field.Name)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(field.Value)
+		if err != nil {
+			return err
+		}
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(v)
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+func (f *jsonFormatter) Write(t time.Time, records []Record) error {
+	var buf bytes.Buffer
+	if f.perDevice {
+		for _, r := range records {
+			if err := writeObject(&buf, r); err != nil {
+				return err
+			}
+			buf.WriteString("\n")
+		}
+	} else {
+		buf.WriteString(`{"timestamp":"` + t.Format(timestampLayout) + `","devices":[`)
+		for i, r := range records {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := writeObject(&buf, r); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]}\n")
+	}
+	_, err := f.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,51 @@
+package output
+
+import (
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// MemoryRecords converts memory deltas to records of sizes and per
+// second rates over the measured interval. Values reported by the guest
+// are unknown unless its balloon driver reports statistics.
+func MemoryRecords(deltas []collector.MemoryDelta) []Record {
+	var records []Record
+	for _, d := range deltas {
+		start := len(records)
+		r := d.Rates()
+		guest := func(v interface{}) interface{} {
+			if !d.Stats.GuestReported {
+				return nil
+			}
+			return v
+		}
+		records = append(records, Record{
+			Time:   d.Time,
+			Domain: d.Domain,
+			UUID:   d.UUID,
+			Device: "memory",
+			Family: "memory",
+			Counters: []Field{
+				{"swap_in", guest(d.Stats.SwapIn)},
+				{"swap_out", guest(d.Stats.SwapOut)},
+				{"major_fault", guest(d.Stats.MajorFault)},
+				{"minor_fault", guest(d.Stats.MinorFault)},
+			},
+			Fields: []Field{
+				{"actual_kB", r.Actual},
+				{"rss_kB", r.RSS},
+				{"unused_kB", guest(r.Unused)},
+				{"avail_kB", guest(r.Available)},
+				{"usable_kB", guest(r.Usable)},
+				{"cache_kB", guest(r.DiskCaches)},
+				{"swpin_kB/s", guest(r.SwapIn)},
+				{"swpout_kB/s", guest(r.SwapOut)},
+				{"majflt/s", guest(r.MajorFault)},
+				{"minflt/s", guest(r.MinorFault)},
+			},
+		})
+		if d.Reset {
+			markReset(records[start:], "actual_kB", "rss_kB", "unused_kB", "avail_kB", "usable_kB", "cache_kB")
+		}
+	}
+	return records
+}
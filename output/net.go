@@ -0,0 +1,50 @@
+package output
+
+import (
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// InterfaceRecords converts network interface deltas to records
+// of per second rates over the measured interval.
+func InterfaceRecords(deltas []collector.InterfaceDelta) []Record {
+	var records []Record
+	for _, d := range deltas {
+		start := len(records)
+		r := d.Rates()
+		records = append(records, Record{
+			Time:   d.Time,
+			Domain: d.Domain,
+			UUID:   d.UUID,
+			Device: d.Interface.Target.Dev,
+			Family: "net",
+			Tags: []Field{
+				{"mac", d.Interface.MAC.Address},
+				{"model", d.Interface.Model.Type},
+			},
+			Counters: []Field{
+				{"rx_bytes", d.Total.RxBytes},
+				{"rx_packets", d.Total.RxPackets},
+				{"rx_errs", d.Total.RxErrs},
+				{"rx_drop", d.Total.RxDrop},
+				{"tx_bytes", d.Total.TxBytes},
+				{"tx_packets", d.Total.TxPackets},
+				{"tx_errs", d.Total.TxErrs},
+				{"tx_drop", d.Total.TxDrop},
+			},
+			Fields: []Field{
+				{"rxpck/s", r.RxPackets},
+				{"txpck/s", r.TxPackets},
+				{"rxkB/s", r.RxKB},
+				{"txkB/s", r.TxKB},
+				{"rxerr/s", r.RxErrs},
+				{"txerr/s", r.TxErrs},
+				{"rxdrop/s", r.RxDrop},
+				{"txdrop/s", r.TxDrop},
+			},
+		})
+		if d.Reset {
+			markReset(records[start:])
+		}
+	}
+	return records
+}
@@ -0,0 +1,410 @@
+package output
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// otlpScope is the instrumentation scope of exported metrics.
+const otlpScope = "virtstat"
+
+// otlpMetric describes an OpenTelemetry metric a field maps to.
+type otlpMetric struct {
+	name string
+	unit string
+	// sum is set for cumulative monotonic sums of raw counters,
+	// fields are gauges otherwise
+	sum bool
+	// attr tells a direction or a kind, like disk.io.direction=read
+	attr Field
+	// scale converts the field to unit, 1 if zero
+	scale float64
+}
+
+// otlpDiskMetrics maps fields and counters of disk records.
+var otlpDiskMetrics = map[string]otlpMetric{
+	"rd_req":            {"virt.disk.operations", "{operation}", true, Field{"disk.io.direction", "read"}, 0},
+	"wr_req":            {"virt.disk.operations", "{operation}", true, Field{"disk.io.direction", "write"}, 0},
+	"rd_bytes":          {"virt.disk.io", "By", true, Field{"disk.io.direction", "read"}, 0},
+	"wr_bytes":          {"virt.disk.io", "By", true, Field{"disk.io.direction", "write"}, 0},
+	"rd_total_times":    {"virt.disk.operation_time", "s", true, Field{"disk.io.direction", "read"}, 1e-9},
+	"wr_total_times":    {"virt.disk.operation_time", "s", true, Field{"disk.io.direction", "write"}, 1e-9},
+	"flush_req":         {"virt.disk.flushes", "{operation}", true, Field{}, 0},
+	"flush_total_times": {"virt.disk.flush_time", "s", true, Field{}, 1e-9},
+	"errs":              {"virt.disk.errors", "{error}", true, Field{}, 0},
+	"r/s":               {"virt.disk.operation.rate", "{operation}/s", false, Field{"disk.io.direction", "read"}, 0},
+	"w/s":               {"virt.disk.operation.rate", "{operation}/s", false, Field{"disk.io.direction", "write"}, 0},
+	"rkB/s":             {"virt.disk.io.rate", "By/s", false, Field{"disk.io.direction", "read"}, 1024},
+	"wkB/s":             {"virt.disk.io.rate", "By/s", false, Field{"disk.io.direction", "write"}, 1024},
+	"r_await":           {"virt.disk.operation.latency", "s", false, Field{"disk.io.direction", "read"}, 1e-3},
+	"w_await":           {"virt.disk.operation.latency", "s", false, Field{"disk.io.direction", "write"}, 1e-3},
+	"flush/s":           {"virt.disk.flush.rate", "{operation}/s", false, Field{}, 0},
+	"f/s":               {"virt.disk.flush.rate", "{operation}/s", false, Field{}, 0},
+	"flush_await":       {"virt.disk.flush.latency", "s", false, Field{}, 1e-3},
+	"f_await":           {"virt.disk.flush.latency", "s", false, Field{}, 1e-3},
+	"aqu-sz":            {"virt.disk.queue.size", "{operation}", false, Field{}, 0},
+	"err/s":             {"virt.disk.error.rate", "{error}/s", false, Field{}, 0},
+	"await":             {"virt.disk.latency", "s", false, Field{}, 1e-3},
+	"rareq-sz":          {"virt.disk.request.size", "By", false, Field{"disk.io.direction", "read"}, 1024},
+	"wareq-sz":          {"virt.disk.request.size", "By", false, Field{"disk.io.direction", "write"}, 1024},
+	"%iops":             {"virt.disk.limit.operations.utilization", "1", false, Field{}, 1e-2},
+	"%r_iops":           {"virt.disk.limit.operations.direction.utilization", "1", false, Field{"disk.io.direction", "read"}, 1e-2},
+	"%w_iops":           {"virt.disk.limit.operations.direction.utilization", "1", false, Field{"disk.io.direction", "write"}, 1e-2},
+	"%bw":               {"virt.disk.limit.io.utilization", "1", false, Field{}, 1e-2},
+	"%r_bw":             {"virt.disk.limit.io.direction.utilization", "1", false, Field{"disk.io.direction", "read"}, 1e-2},
+	"%w_bw":             {"virt.disk.limit.io.direction.utilization", "1", false, Field{"disk.io.direction", "write"}, 1e-2},
+	"%iops_max":         {"virt.disk.limit.operations.burst.utilization", "1", false, Field{}, 1e-2},
+	"%bw_max":           {"virt.disk.limit.io.burst.utilization", "1", false, Field{}, 1e-2},
+	"capped":            {"virt.disk.limit.capped", "1", false, Field{}, 0},
+}
+
+/* otlpLayerMetrics returns metrics of backing chain layers, named
+ * like ones of disk under virt.disk.layer, so layers do not add up
+ * to disks, and their allocation.
+ */
+func otlpLayerMetrics(disk map[string]otlpMetric) map[string]otlpMetric {
+	layer := map[string]otlpMetric{
+		"depth":     {"virt.disk.layer.depth", "1", false, Field{}, 0},
+		"alloc_MB":  {"virt.disk.layer.allocation", "By", false, Field{}, 1024 * 1024},
+		"grow_kB/s": {"virt.disk.layer.allocation.rate", "By/s", false, Field{}, 1024},
+	}
+	for name, m := range disk {
+		m.name = "virt.disk.layer." + strings.TrimPrefix(m.name, "virt.disk.")
+		layer[name] = m
+	}
+	return layer
+}
+
+// otlpMetrics maps record fields and counters to metrics by family,
+// ones not listed are not exported.
+var otlpMetrics = map[string]map[string]otlpMetric{
+	"disk":  otlpDiskMetrics,
+	"layer": otlpLayerMetrics(otlpDiskMetrics),
+	"capacity": {
+		"capacity":   {"virt.disk.capacity", "By", false, Field{}, 0},
+		"allocation": {"virt.disk.allocation", "By", false, Field{}, 0},
+		"physical":   {"virt.disk.physical", "By", false, Field{}, 0},
+		"%used":      {"virt.disk.allocation.utilization", "1", false, Field{}, 1e-2},
+		"grow_kB/s":  {"virt.disk.allocation.rate", "By/s", false, Field{}, 1024},
+	},
+	"net": {
+		"rx_bytes":   {"virt.network.io", "By", true, Field{"network.io.direction", "receive"}, 0},
+		"tx_bytes":   {"virt.network.io", "By", true, Field{"network.io.direction", "transmit"}, 0},
+		"rx_packets": {"virt.network.packets", "{packet}", true, Field{"network.io.direction", "receive"}, 0},
+		"tx_packets": {"virt.network.packets", "{packet}", true, Field{"network.io.direction", "transmit"}, 0},
+		"rx_errs":    {"virt.network.errors", "{error}", true, Field{"network.io.direction", "receive"}, 0},
+		"tx_errs":    {"virt.network.errors", "{error}", true, Field{"network.io.direction", "transmit"}, 0},
+		"rx_drop":    {"virt.network.dropped", "{packet}", true, Field{"network.io.direction", "receive"}, 0},
+		"tx_drop":    {"virt.network.dropped", "{packet}", true, Field{"network.io.direction", "transmit"}, 0},
+		"rxkB/s":     {"virt.network.io.rate", "By/s", false, Field{"network.io.direction", "receive"}, 1024},
+		"txkB/s":     {"virt.network.io.rate", "By/s", false, Field{"network.io.direction", "transmit"}, 1024},
+		"rxpck/s":    {"virt.network.packet.rate", "{packet}/s", false, Field{"network.io.direction", "receive"}, 0},
+		"txpck/s":    {"virt.network.packet.rate", "{packet}/s", false, Field{"network.io.direction", "transmit"}, 0},
+		"rxerr/s":    {"virt.network.error.rate", "{error}/s", false, Field{"network.io.direction", "receive"}, 0},
+		"txerr/s":    {"virt.network.error.rate", "{error}/s", false, Field{"network.io.direction", "transmit"}, 0},
+		"rxdrop/s":   {"virt.network.dropped.rate", "{packet}/s", false, Field{"network.io.direction", "receive"}, 0},
+		"txdrop/s":   {"virt.network.dropped.rate", "{packet}/s", false, Field{"network.io.direction", "transmit"}, 0},
+	},
+	"cpu": {
+		"cpu_time":    {"virt.cpu.time", "s", true, Field{}, 1e-9},
+		"user_time":   {"virt.cpu.mode.time", "s", true, Field{"cpu.mode", "user"}, 1e-9},
+		"system_time": {"virt.cpu.mode.time", "s", true, Field{"cpu.mode", "system"}, 1e-9},
+		"%cpu":        {"virt.cpu.utilization", "1", false, Field{}, 1e-2},
+		"%user":       {"virt.cpu.mode.utilization", "1", false, Field{"cpu.mode", "user"}, 1e-2},
+		"%system":     {"virt.cpu.mode.utilization", "1", false, Field{"cpu.mode", "system"}, 1e-2},
+		"%vcpu":       {"virt.vcpu.utilization", "1", false, Field{}, 1e-2},
+		"pcpu":        {"virt.vcpu.physical_cpu", "1", false, Field{}, 0},
+	},
+	"memory": {
+		"swap_in":     {"virt.memory.swap", "By", true, Field{"virt.memory.swap.direction", "in"}, 1024},
+		"swap_out":    {"virt.memory.swap", "By", true, Field{"virt.memory.swap.direction", "out"}, 1024},
+		"major_fault": {"virt.memory.page_faults", "{fault}", true, Field{"system.paging.type", "major"}, 0},
+		"minor_fault": {"virt.memory.page_faults", "{fault}", true, Field{"system.paging.type", "minor"}, 0},
+		"swpin_kB/s":  {"virt.memory.swap.rate", "By/s", false, Field{"virt.memory.swap.direction", "in"}, 1024},
+		"swpout_kB/s": {"virt.memory.swap.rate", "By/s", false, Field{"virt.memory.swap.direction", "out"}, 1024},
+		"majflt/s":    {"virt.memory.page_fault.rate", "{fault}/s", false, Field{"system.paging.type", "major"}, 0},
+		"minflt/s":    {"virt.memory.page_fault.rate", "{fault}/s", false, Field{"system.paging.type", "minor"}, 0},
+		"actual_kB":   {"virt.memory.balloon", "By", false, Field{}, 1024},
+		"rss_kB":      {"virt.memory.rss", "By", false, Field{}, 1024},
+		"unused_kB":   {"virt.memory.unused", "By", false, Field{}, 1024},
+		"avail_kB":    {"virt.memory.available", "By", false, Field{}, 1024},
+		"usable_kB":   {"virt.memory.usable", "By", false, Field{}, 1024},
+		"cache_kB":    {"virt.memory.disk_cache", "By", false, Field{}, 1024},
+	},
+}
+
+// otlpPoint is a data point, value is int64 or float64.
+type otlpPoint struct {
+	attrs []Field
+	start time.Time
+	time  time.Time
+	value interface{}
+}
+
+type otlpData struct {
+	otlpMetric
+	points []otlpPoint
+}
+
+// otlpResource holds metrics of a host.
+type otlpResource struct {
+	attrs   []Field
+	metrics []*otlpData
+}
+
+/* otlpFormatter writes an OTLP export metrics request, protobuf
+ * encoded, per interval. Raw counters are cumulative sums starting
+ * when a device was seen first or when its counters were reset,
+ * rates are gauges. Records of a host make a resource, resource
+ * attributes are told by resource if set.
+ */
+type otlpFormatter struct {
+	w        io.Writer
+	resource func(host string) []Field
+	// start holds start time of counters of a device
+	start map[string]time.Time
+	// last holds time counters of a device were seen last
+	last map[string]time.Time
+}
+
+/* NewOTLP returns a formatter of OTLP metrics export requests, as
+ * sent to an OpenTelemetry collector over HTTP or gRPC. resource returns
+ * attributes of the resource of host, like host.name, host is empty
+ * if a single hypervisor is monitored. resource may be nil.
+ */
+func NewOTLP(w io.Writer, resource func(host string) []Field) Formatter {
+	return &otlpFormatter{
+		w:        w,
+		resource: resource,
+		start:    make(map[string]time.Time),
+		last:     make(map[string]time.Time),
+	}
+}
+
+// otlpValue converts v to unit of m, ok is false if v is unknown.
+func otlpValue(m otlpMetric, v interface{}) (res interface{}, ok bool) {
+	scale := m.scale
+	if scale == 0 {
+		scale = 1
+	}
+	switch v := v.(type) {
+	case int64:
+		if s := int64(scale); float64(s) == scale {
+			return v * s, true
+		}
+		return float64(v) * scale, true
+	case float64:
+		return v * scale, true
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	}
+	return nil, false
+}
+
+// counterStart returns start time of counters of device key of r.
+// Devices not in records of the interval are forgotten.
+func (f *otlpFormatter) counterStart(key string, r Record, seen map[string]bool) time.Time {
+	if !seen[key] {
+		seen[key] = true
+		start, ok := f.start[key]
+		switch {
+		case !ok:
+			start = r.Time
+		case r.Event == resetEvent:
+			// Counters were reset after they were seen last
+			start = f.last[key]
+		}
+		f.start[key] = start
+		f.last[key] = r.Time
+	}
+	return f.start[key]
+}
+
+// resources groups data points of records by host and metric.
+func (f *otlpFormatter) resources(records []Record) []*otlpResource {
+	var res []*otlpResource
+	byHost := make(map[string]*otlpResource)
+	byName := make(map[string]*otlpData)
+	seen := make(map[string]bool)
+	for _, r := range records {
+		metrics := otlpMetrics[r.Family]
+		if metrics == nil {
+			continue
+		}
+		attrs := []Field{
+			{"virt.domain.name", r.Domain},
+			{"virt.domain.uuid", r.UUID},
+			{"virt.device", r.Device},
+		}
+		key := r.Host + "\x00" + r.UUID + "\x00" + r.Family + "\x00" + r.Device
+		for _, field := range append(append([]Field{}, r.Counters...), r.Fields...) {
+			m, ok := metrics[field.Name]
+			if !ok {
+				continue
+			}
+			v, ok := otlpValue(m, field.Value)
+			if !ok {
+				continue
+			}
+			rs := byHost[r.Host]
+			if rs == nil {
+				rs = &otlpResource{}
+				if f.resource != nil {
+					rs.attrs = f.resource(r.Host)
+				}
+				byHost[r.Host] = rs
+				res = append(res, rs)
+			}
+			d := byName[r.Host+"\x00"+m.name]
+			if d == nil {
+				d = &otlpData{otlpMetric: m}
+				byName[r.Host+"\x00"+m.name] = d
+				rs.metrics = append(rs.metrics, d)
+			}
+			p := otlpPoint{attrs: attrs, time: r.Time, value: v}
+			if m.attr.Name != "" {
+				p.attrs = append(attrs[:len(attrs):len(attrs)], m.attr)
+			}
+			if m.sum {
+				p.start = f.counterStart(key, r, seen)
+			}
+			d.points = append(d.points, p)
+		}
+	}
+	for key := range f.start {
+		if !seen[key] {
+			delete(f.start, key)
+			delete(f.last, key)
+		}
+	}
+	return res
+}
+
+func (f *otlpFormatter) Write(t time.Time, records []Record) error {
+	var req protobuf
+	for _, rs := range f.resources(records) {
+		req.message(1, rs.encode())
+	}
+	if len(req) == 0 {
+		return nil
+	}
+	_, err := f.w.Write(req)
+	return err
+}
+
+// protobuf is a message in protocol buffers wire format.
+type protobuf []byte
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func (b *protobuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protobuf) key(field, wire int) {
+	b.varint(uint64(field<<3 | wire))
+}
+
+func (b *protobuf) uint(field int, v uint64) {
+	b.key(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *protobuf) fixed64(field int, v uint64) {
+	b.key(field, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	*b = append(*b, buf[:]...)
+}
+
+func (b *protobuf) message(field int, m protobuf) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+func (b *protobuf) string(field int, s string) {
+	b.message(field, protobuf(s))
+}
+
+// attribute appends a KeyValue of a string attribute, empty
+// values are skipped.
+func (b *protobuf) attribute(field int, a Field) {
+	s, _ := a.Value.(string)
+	if s == "" {
+		return
+	}
+	var value, kv protobuf
+	value.string(1, s)
+	kv.string(1, a.Name)
+	kv.message(2, value)
+	b.message(field, kv)
+}
+
+// aggregationCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const aggregationCumulative = 2
+
+func (p otlpPoint) encode() protobuf {
+	var b protobuf
+	if !p.start.IsZero() {
+		b.fixed64(2, uint64(p.start.UnixNano()))
+	}
+	b.fixed64(3, uint64(p.time.UnixNano()))
+	switch v := p.value.(type) {
+	case float64:
+		b.fixed64(4, math.Float64bits(v))
+	case int64:
+		b.fixed64(6, uint64(v))
+	}
+	for _, a := range p.attrs {
+		b.attribute(7, a)
+	}
+	return b
+}
+
+func (d *otlpData) encode() protobuf {
+	var data protobuf
+	for _, p := range d.points {
+		data.message(1, p.encode())
+	}
+	var m protobuf
+	m.string(1, d.name)
+	m.string(3, d.unit)
+	if d.sum {
+		data.uint(2, aggregationCumulative)
+		data.uint(3, 1)
+		m.message(7, data)
+	} else {
+		m.message(5, data)
+	}
+	return m
+}
+
+func (rs *otlpResource) encode() protobuf {
+	var resource, scope, scopeMetrics, b protobuf
+	for _, a := range rs.attrs {
+		resource.attribute(1, a)
+	}
+	scope.string(1, otlpScope)
+	scopeMetrics.message(1, scope)
+	for _, d := range rs.metrics {
+		scopeMetrics.message(2, d.encode())
+	}
+	b.message(1, resource)
+	b.message(2, scopeMetrics)
+	return b
+}
@@ -0,0 +1,99 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+func TestProtobuf(t *testing.T) {
+	var b protobuf
+	b.uint(1, 300)
+	b.attribute(2, Field{"k", "v"})
+	b.attribute(2, Field{"empty", ""})
+	want := []byte{0x08, 0xac, 0x02, 0x12, 0x08, 0x0a, 0x01, 'k', 0x12, 0x03, 0x0a, 0x01, 'v'}
+	if !bytes.Equal(b, want) {
+		t.Errorf("got % x, want % x", []byte(b), want)
+	}
+}
+
+// TestOTLPMetrics checks every number written by other formats
+// is exported.
+func TestOTLPMetrics(t *testing.T) {
+	skip := map[string]bool{
+		// Strings
+		"group": true, "format": true, "path": true, "state": true, "full_in": true,
+		// Sizes exported in bytes from counters
+		"cap_MB": true, "phys_MB": true,
+	}
+	var records []Record
+	records = append(records, DiskRecords([]collector.Delta{{}})...)
+	records = append(records, ExtendedDiskRecords([]collector.Delta{{}})...)
+	records = append(records, ThrottleDiskRecords([]collector.Delta{{}})...)
+	records = append(records, InterfaceRecords([]collector.InterfaceDelta{{}})...)
+	records = append(records, CPURecords([]collector.CPUDelta{{Vcpus: []collector.VcpuStats{{}}}})...)
+	records = append(records, MemoryRecords([]collector.MemoryDelta{{}})...)
+	records = append(records, CapacityRecords([]collector.CapacityDelta{{}})...)
+	records = append(records, LayerRecords([]collector.LayerDelta{{}})...)
+	for _, r := range records {
+		for _, f := range append(r.Fields, r.Counters...) {
+			if skip[f.Name] || (r.Family == "capacity" && f.Name == "alloc_MB") {
+				continue
+			}
+			if _, ok := otlpMetrics[r.Family][f.Name]; !ok {
+				t.Errorf("%s %s is not exported", r.Family, f.Name)
+			}
+		}
+	}
+}
+
+// TestOTLPStart checks counters start when a device is seen first
+// and again after a reset, rates are gauges.
+func TestOTLPStart(t *testing.T) {
+	t0 := time.Unix(1540000000, 0)
+	f := NewOTLP(new(bytes.Buffer), nil).(*otlpFormatter)
+	record := func(t time.Time, req int64, event string) Record {
+		return Record{
+			Time:     t,
+			Domain:   "web",
+			UUID:     "u-1",
+			Device:   "vda",
+			Family:   "disk",
+			Fields:   []Field{{"r/s", 1.5}, {"rkB/s", nil}},
+			Counters: []Field{{"rd_req", req}},
+			Event:    event,
+		}
+	}
+	tests := []struct {
+		r     Record
+		start time.Time
+	}{
+		{record(t0, 100, ""), t0},
+		{record(t0.Add(time.Second), 200, ""), t0},
+		{record(t0.Add(2*time.Second), 5, resetEvent), t0.Add(time.Second)},
+		{record(t0.Add(3*time.Second), 10, ""), t0.Add(time.Second)},
+	}
+	for i, tt := range tests {
+		res := f.resources([]Record{tt.r})
+		if len(res) != 1 || len(res[0].metrics) != 2 {
+			t.Fatalf("%d: got %d resources, want 1 with 2 metrics", i, len(res))
+		}
+		sum, gauge := res[0].metrics[0], res[0].metrics[1]
+		if sum.name != "virt.disk.operations" || !sum.sum || gauge.name != "virt.disk.operation.rate" || gauge.sum {
+			t.Fatalf("%d: got metrics %s and %s", i, sum.name, gauge.name)
+		}
+		p := sum.points[0]
+		if !p.start.Equal(tt.start) || p.value != tt.r.Counters[0].Value {
+			t.Errorf("%d: got start %v value %v, want %v %v", i, p.start, p.value, tt.start, tt.r.Counters[0].Value)
+		}
+		if a := p.attrs[len(p.attrs)-1]; a.Name != "disk.io.direction" || a.Value != "read" {
+			t.Errorf("%d: got attribute %v", i, a)
+		}
+	}
+	f.resources(nil)
+	if len(f.start) != 0 {
+		t.Errorf("devices gone are not forgotten")
+	}
+}
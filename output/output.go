@@ -0,0 +1,122 @@
+// Package output formats collected statistics.
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+// Field is a named value of a record. Value is either int64, float64,
+// string, bool or nil if the value is unknown.
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// Record is a row of statistics of a single device.
+// Host is set when several hypervisors are monitored. Event notes
+// a change of the domain or device, records of events alone have
+// no fields.
+// Family names statistics the record belongs to, like "disk" or "net".
+// Tags describe the device and Counters hold its raw counters, they
+// are only written by formats feeding time series databases.
+type Record struct {
+	Time     time.Time
+	Host     string
+	Domain   string
+	UUID     string
+	Device   string
+	Family   string
+	Tags     []Field
+	Fields   []Field
+	Counters []Field
+	Event    string
+}
+
+// Formatter writes records collected during one interval.
+type Formatter interface {
+	Write(t time.Time, records []Record) error
+}
+
+// Formats lists supported output formats.
+var Formats = []string{"table", "json", "ndjson", "csv", "tsv", "influx", "graphite", "statsd", "otlp", "zabbix"}
+
+// New returns a formatter of the given format writing to w.
+func New(format string, w io.Writer) (Formatter, error) {
+	switch format {
+	case "table":
+		return &tableFormatter{w: w}, nil
+	case "json":
+		return &jsonFormatter{w: w}, nil
+	case "ndjson":
+		return &jsonFormatter{w: w, perDevice: true}, nil
+	case "csv":
+		return newCSVFormatter(w, ','), nil
+	case "tsv":
+		return newCSVFormatter(w, '\t'), nil
+	case "influx":
+		return &influxFormatter{w: w}, nil
+	case "graphite", "statsd":
+		return NewGraphite(w, DefaultTemplate, format == "statsd")
+	case "otlp":
+		return NewOTLP(w, nil), nil
+	case "zabbix":
+		return NewZabbix(w, ""), nil
+	}
+	return nil, fmt.Errorf("%s: unknown output format", format)
+}
+
+// EventRecords converts events to records without fields.
+func EventRecords(events []collector.Event) []Record {
+	var records []Record
+	for _, e := range events {
+		records = append(records, Record{
+			Time:   e.Time,
+			Domain: e.Domain,
+			UUID:   e.UUID,
+			Device: e.Device,
+			Family: "event",
+			Event:  e.Message,
+		})
+	}
+	return records
+}
+
+// resetEvent notes records of a delta over a counters reset.
+const resetEvent = "counters reset"
+
+// markReset marks records of a delta over a counters reset, their
+// rates are unknown. Fields named by gauges are sizes, they are kept.
+func markReset(records []Record, gauges ...string) {
+	for i := range records {
+	fields:
+		for j, field := range records[i].Fields {
+			if _, ok := field.Value.(float64); !ok {
+				continue
+			}
+			for _, g := range gauges {
+				if field.Name == g {
+					continue fields
+				}
+			}
+			records[i].Fields[j].Value = nil
+		}
+		records[i].Event = resetEvent
+	}
+}
+
+// metricNameReplacer turns column names like "r/s" or "%cpu"
+// into metric names which need no quoting in queries.
+var metricNameReplacer = strings.NewReplacer("/", "_per_", "%", "pct_", "-", "_")
+
+// metricName returns name of a metric of field name.
+func metricName(name string) string {
+	return metricNameReplacer.Replace(name)
+}
+
+// timestampLayout is used by machine-readable formats.
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
@@ -0,0 +1,49 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMarkReset(t *testing.T) {
+	records := []Record{{Fields: []Field{
+		{"depth", int64(1)},
+		{"r/s", 12.0},
+		{"alloc_MB", 512.0},
+		{"grow_kB/s", 4.0},
+	}}}
+	markReset(records, "alloc_MB")
+	want := []interface{}{int64(1), nil, 512.0, nil}
+	for i, f := range records[0].Fields {
+		if f.Value != want[i] {
+			t.Errorf("%s = %v, want %v", f.Name, f.Value, want[i])
+		}
+	}
+	if records[0].Event != resetEvent {
+		t.Errorf("event = %q", records[0].Event)
+	}
+}
+
+// TestCSVHeader checks the header holds the columns given even if
+// the first interval has only events.
+func TestCSVHeader(t *testing.T) {
+	var buf bytes.Buffer
+	f := NewCSV(&buf, ',', []string{"r/s", "w/s"}, true)
+	t0 := time.Unix(1540000000, 0).UTC()
+	event := Record{Time: t0, Host: "kvm1", Domain: "web", Event: "domain started"}
+	if err := f.Write(t0, []Record{event}); err != nil {
+		t.Fatal(err)
+	}
+	disk := Record{Time: t0, Host: "kvm1", Domain: "web", Device: "vda", Fields: []Field{{"w/s", 2.0}}}
+	if err := f.Write(t0, []Record{disk}); err != nil {
+		t.Fatal(err)
+	}
+	ts := t0.Format(timestampLayout)
+	want := "host,domain,uuid,device,timestamp,r/s,w/s,event\n" +
+		"kvm1,web,,," + ts + ",,,domain started\n" +
+		"kvm1,web,,vda," + ts + ",,2,\n"
+	if buf.String() != want {
+		t.Errorf("got\n%swant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,120 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// tableFormatter prints fixed-width iostat-like tables.
+// Records of several domains are printed in one block per domain.
+type tableFormatter struct {
+	w io.Writer
+}
+
+func (f *tableFormatter) writeHeader(r Record) {
+	fmt.Fprintf(f.w, "%1s", "Device:")
+	for i, field := range r.Fields {
+		if i == 0 {
+			fmt.Fprintf(f.w, "%10s", field.Name)
+		} else {
+			fmt.Fprintf(f.w, "%12s", field.Name)
+		}
+	}
+	fmt.Fprintf(f.w, "\n")
+}
+
+func (f *tableFormatter) writeRow(r Record) {
+	fmt.Fprintf(f.w, "%1s", r.Device)
+	for _, field := range r.Fields {
+		switch v := field.Value.(type) {
+		case int64:
+			fmt.Fprintf(f.w, "%12d", v)
+		case float64:
+			fmt.Fprintf(f.w, "%12.2f", v)
+		case string:
+			fmt.Fprintf(f.w, "%12s", v)
+		case bool:
+			if v {
+				fmt.Fprintf(f.w, "%12s", "yes")
+			} else {
+				fmt.Fprintf(f.w, "%12s", "no")
+			}
+		case nil:
+			fmt.Fprintf(f.w, "%12s", "-")
+		}
+	}
+	if r.Event != "" {
+		fmt.Fprintf(f.w, "  %s", r.Event)
+	}
+	fmt.Fprintf(f.w, "\n")
+}
+
+// writeEvent prints a record of an event alone.
+func (f *tableFormatter) writeEvent(r Record) {
+	if r.Device != "" {
+		fmt.Fprintf(f.w, "Event: %s %s: %s\n", r.Domain, r.Device, r.Event)
+	} else {
+		fmt.Fprintf(f.w, "Event: %s: %s\n", r.Domain, r.Event)
+	}
+}
+
+// sameFields reports whether a and b have the same columns.
+func sameFields(a, b Record) bool {
+	if len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for i := range a.Fields {
+		if a.Fields[i].Name != b.Fields[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *tableFormatter) Write(t time.Time, records []Record) error {
+	fmt.Fprintf(f.w, "%d-%02d-%02d %02d:%02d:%02d\n",
+		t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second())
+	// Group records by host and domain keeping the order
+	type key struct {
+		host, uuid string
+	}
+	var keys []key
+	byDomain := make(map[key][]Record)
+	for _, r := range records {
+		k := key{r.Host, r.UUID}
+		if _, ok := byDomain[k]; !ok {
+			keys = append(keys, k)
+		}
+		byDomain[k] = append(byDomain[k], r)
+	}
+	for i, k := range keys {
+		rs := byDomain[k]
+		if len(keys) > 1 || k.host != "" {
+			if i > 0 {
+				fmt.Fprintf(f.w, "\n")
+			}
+			if k.host != "" {
+				fmt.Fprintf(f.w, "Domain: %s (%s) on %s\n", rs[0].Domain, k.uuid, k.host)
+			} else {
+				fmt.Fprintf(f.w, "Domain: %s (%s)\n", rs[0].Domain, k.uuid)
+			}
+		}
+		var last *Record
+		for j, r := range rs {
+			if len(r.Fields) == 0 {
+				f.writeEvent(r)
+				continue
+			}
+			// Print header again if columns change
+			if last == nil || !sameFields(*last, r) {
+				f.writeHeader(r)
+			}
+			f.writeRow(r)
+			last = &rs[j]
+		}
+	}
+	_, err := fmt.Fprintf(f.w, "\n")
+	return err
+}
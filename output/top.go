@@ -0,0 +1,91 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// rank returns sum of numeric fields of r named by,
+// ok is false if r lacks any of them.
+func rank(r Record, by []string) (sum float64, ok bool) {
+	for _, name := range by {
+		found := false
+		for _, field := range r.Fields {
+			if field.Name != name {
+				continue
+			}
+			switch v := field.Value.(type) {
+			case int64:
+				sum += float64(v)
+				found = true
+			case float64:
+				sum += v
+				found = true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return sum, true
+}
+
+// Top returns up to n records with the highest sum of fields named by,
+// in descending order. Records lacking any of the fields are skipped.
+func Top(records []Record, by []string, n int) []Record {
+	type ranked struct {
+		r    Record
+		rank float64
+	}
+	var rs []ranked
+	for _, r := range records {
+		if v, ok := rank(r, by); ok {
+			rs = append(rs, ranked{r, v})
+		}
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].rank > rs[j].rank
+	})
+	if len(rs) > n {
+		rs = rs[:n]
+	}
+	top := make([]Record, 0, len(rs))
+	for _, r := range rs {
+		top = append(top, r.r)
+	}
+	return top
+}
+
+// topTableFormatter prints ranked records of many hosts and domains
+// as a single table, every row names its host and domain.
+type topTableFormatter struct {
+	tableFormatter
+}
+
+func (f *topTableFormatter) Write(t time.Time, records []Record) error {
+	fmt.Fprintf(f.w, "%d-%02d-%02d %02d:%02d:%02d\n",
+		t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second())
+	for i, r := range records {
+		if i == 0 || !sameFields(records[i-1], r) {
+			fmt.Fprintf(f.w, "%-16s %-24s ", "Host:", "Domain:")
+			f.writeHeader(r)
+		}
+		fmt.Fprintf(f.w, "%-16s %-24s ", r.Host, r.Domain)
+		f.writeRow(r)
+	}
+	_, err := fmt.Fprintf(f.w, "\n")
+	return err
+}
+
+// NewTop returns a formatter of ranked records of the given format.
+// Machine-readable formats are the same as returned by New, they keep
+// records order and carry host and domain of every record anyway.
+func NewTop(format string, w io.Writer) (Formatter, error) {
+	if format == "table" {
+		return &topTableFormatter{tableFormatter{w: w}}, nil
+	}
+	return New(format, w)
+}
@@ -0,0 +1,209 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// zabbixItem is a value of an item of the Zabbix sender protocol.
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock,omitempty"`
+	NS    int    `json:"ns,omitempty"`
+}
+
+// zabbixRequest is a request of the Zabbix sender protocol.
+type zabbixRequest struct {
+	Request string       `json:"request"`
+	Data    []zabbixItem `json:"data"`
+}
+
+// writeZabbixRequest writes items as a sender request,
+// a line of JSON.
+func writeZabbixRequest(w io.Writer, items []zabbixItem) error {
+	b, err := json.Marshal(zabbixRequest{Request: "sender data", Data: items})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+var zabbixQuoter = strings.NewReplacer(`"`, `\"`)
+
+// zabbixKey returns item key name with params, every param is quoted.
+func zabbixKey(name string, params ...string) string {
+	quoted := make([]string, len(params))
+	for i, p := range params {
+		quoted[i] = `"` + zabbixQuoter.Replace(p) + `"`
+	}
+	return name + "[" + strings.Join(quoted, ",") + "]"
+}
+
+// zabbixValue formats a value, ok is false if v is unknown.
+func zabbixValue(v interface{}) (s string, ok bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	}
+	return graphiteValue(v)
+}
+
+/* zabbixFormatter writes a Zabbix sender request per interval. Items
+ * belong to the hypervisor, record host or host, keys are like
+ * virtstat.disk["domain","vda","r/s"]. Events are values of
+ * virtstat.event.
+ */
+type zabbixFormatter struct {
+	w    io.Writer
+	host string
+}
+
+// NewZabbix returns a formatter of Zabbix sender requests, items of
+// records without a host are sent for host.
+func NewZabbix(w io.Writer, host string) Formatter {
+	return &zabbixFormatter{w: w, host: host}
+}
+
+func (f *zabbixFormatter) Write(t time.Time, records []Record) error {
+	var items []zabbixItem
+	for _, r := range records {
+		host := r.Host
+		if host == "" {
+			host = f.host
+		}
+		item := func(key, value string) {
+			items = append(items, zabbixItem{
+				Host:  host,
+				Key:   key,
+				Value: value,
+				Clock: r.Time.Unix(),
+				NS:    r.Time.Nanosecond(),
+			})
+		}
+		if r.Event != "" {
+			msg := r.Domain
+			if r.Device != "" {
+				msg += " " + r.Device
+			}
+			item("virtstat.event", msg+": "+r.Event)
+		}
+		for _, field := range r.Fields {
+			if v, ok := zabbixValue(field.Value); ok {
+				item(zabbixKey("virtstat."+r.Family, r.Domain, r.Device, field.Name), v)
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return writeZabbixRequest(f.w, items)
+}
+
+// DiscoveryKinds lists kinds of objects of Zabbix low-level discovery.
+var DiscoveryKinds = []string{"domains", "disks", "interfaces"}
+
+/* discovery returns Zabbix low-level discovery objects of kind
+ * of inv, their macros are {#DOMAIN} and {#UUID}, and {#DISK},
+ * {#SERIAL} and {#BUS} of disks or {#IFACE}, {#MAC} and {#MODEL}
+ * of interfaces. {#HOST} is set if inv has hosts.
+ */
+func discovery(kind string, inv []Inventory) ([]map[string]string, error) {
+	switch kind {
+	case "domains", "disks", "interfaces":
+	default:
+		return nil, fmt.Errorf("%s: unknown discovery, use %s", kind, strings.Join(DiscoveryKinds, ", "))
+	}
+	objects := []map[string]string{}
+	for _, i := range inv {
+		object := func(macros ...string) {
+			o := map[string]string{
+				"{#DOMAIN}": i.Name,
+				"{#UUID}":   i.UUID,
+			}
+			if i.Host != "" {
+				o["{#HOST}"] = i.Host
+			}
+			for n := 0; n+1 < len(macros); n += 2 {
+				o[macros[n]] = macros[n+1]
+			}
+			objects = append(objects, o)
+		}
+		switch kind {
+		case "domains":
+			object("{#STATE}", i.Info.StateName())
+		case "disks":
+			for _, d := range i.Disks {
+				object("{#DISK}", d.Target.DiskName, "{#SERIAL}", d.Serial, "{#BUS}", d.Target.DiskBus)
+			}
+		case "interfaces":
+			for _, v := range i.Interfaces {
+				object("{#IFACE}", v.Target.Dev, "{#MAC}", v.MAC.Address, "{#MODEL}", v.Model.Type)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// WriteDiscovery writes Zabbix low-level discovery JSON
+// of objects of kind of inv.
+func WriteDiscovery(w io.Writer, kind string, inv []Inventory) error {
+	objects, err := discovery(kind, inv)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"data": objects})
+}
+
+/* WriteDiscoverySender writes low-level discovery of objects of kind
+ * of every host of inv as a sender request, a value of the trapper
+ * key virtstat.<kind>.discovery. Inventory without a host is sent
+ * for host.
+ */
+func WriteDiscoverySender(w io.Writer, kind string, inv []Inventory, host string) error {
+	var hosts []string
+	byHost := make(map[string][]Inventory)
+	for _, i := range inv {
+		if _, ok := byHost[i.Host]; !ok {
+			hosts = append(hosts, i.Host)
+		}
+		// Items belong to the host, no {#HOST} is needed
+		h := i.Host
+		i.Host = ""
+		byHost[h] = append(byHost[h], i)
+	}
+	if len(hosts) == 0 {
+		// Empty discovery lets Zabbix remove items of domains gone
+		hosts = []string{""}
+	}
+	var items []zabbixItem
+	for _, h := range hosts {
+		objects, err := discovery(kind, byHost[h])
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(map[string]interface{}{"data": objects})
+		if err != nil {
+			return err
+		}
+		if h == "" {
+			h = host
+		}
+		items = append(items, zabbixItem{
+			Host:  h,
+			Key:   "virtstat." + kind + ".discovery",
+			Value: string(b),
+			Clock: time.Now().Unix(),
+		})
+	}
+	return writeZabbixRequest(w, items)
+}
@@ -0,0 +1,53 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+)
+
+func TestZabbix(t *testing.T) {
+	var buf bytes.Buffer
+	f := NewZabbix(&buf, "kvm1")
+	r := Record{
+		Time:   time.Unix(1540000000, 5),
+		Domain: `web "1"`,
+		Device: "vda",
+		Family: "disk",
+		Fields: []Field{{"r/s", 1.5}, {"w/s", nil}},
+		Event:  "counters reset",
+	}
+	if err := f.Write(r.Time, []Record{r}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"request":"sender data","data":[` +
+		`{"host":"kvm1","key":"virtstat.event","value":"web \"1\" vda: counters reset","clock":1540000000,"ns":5},` +
+		`{"host":"kvm1","key":"virtstat.disk[\"web \\\"1\\\"\",\"vda\",\"r/s\"]","value":"1.5","clock":1540000000,"ns":5}]}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got\n%swant\n%s", buf.String(), want)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	var d collector.DomainInventory
+	d.Name = "web"
+	d.UUID = "u-1"
+	d.Disks = make([]collector.Disk, 1)
+	d.Disks[0].Target.DiskName = "vda"
+	d.Disks[0].Serial = "s-1"
+	inv := []Inventory{{Host: "kvm1", DomainInventory: d}}
+	var buf bytes.Buffer
+	if err := WriteDiscoverySender(&buf, "disks", inv, "local"); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"request":"sender data","data":[{"host":"kvm1","key":"virtstat.disks.discovery",` +
+		`"value":"{\"data\":[{\"{#BUS}\":\"\",\"{#DISK}\":\"vda\",\"{#DOMAIN}\":\"web\",\"{#SERIAL}\":\"s-1\",\"{#UUID}\":\"u-1\"}]}","clock":`
+	if !bytes.HasPrefix(buf.Bytes(), []byte(want)) {
+		t.Errorf("got\n%swant\n%s...", buf.String(), want)
+	}
+	if err := WriteDiscovery(&buf, "vcpus", inv); err == nil {
+		t.Errorf("unknown discovery: no error")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/AlexZzz/virtstat/collector"
+	"github.com/AlexZzz/virtstat/output"
+)
+
+/* sampler samples one family of statistics of the
+ * monitored domains and turns them into output records
+ */
+type sampler interface {
+	sample() ([]output.Record, error)
+}
+
+// samplerFunc creates a sampler of domains doms.
+type samplerFunc func(b collector.Backend, doms []collector.Domain) (sampler, error)
+
+/* columns returns names of fields reported by command with the view
+ * selected, the records of an empty delta hold every one of them.
+ */
+func columns(command string) []string {
+	var records []output.Record
+	switch command {
+	case "disk":
+		records = diskRecords([]collector.Delta{{}})
+		if backing {
+			records = output.LayerRecords([]collector.LayerDelta{{}})
+		}
+	case "net":
+		records = output.InterfaceRecords([]collector.InterfaceDelta{{}})
+	case "cpu":
+		records = output.CPURecords([]collector.CPUDelta{{Vcpus: make([]collector.VcpuStats, 1)}})
+	case "mem":
+		records = output.MemoryRecords([]collector.MemoryDelta{{}})
+	case "df":
+		records = output.CapacityRecords([]collector.CapacityDelta{{}})
+	}
+	return output.Columns(records)
+}
+
+// diskRecords converts disk deltas to records of the view selected.
+func diskRecords(deltas []collector.Delta) []output.Record {
+	switch {
+	case throttle:
+		return output.ThrottleDiskRecords(deltas)
+	case extended:
+		return output.ExtendedDiskRecords(deltas)
+	}
+	return output.DiskRecords(deltas)
+}
+
+/* sampleEach runs sample over every collector at once and, if that
+ * fails, over every collector alone. Collectors which fail alone are
+ * reported as events, their domain has likely just stopped and
+ * the next refresh drops it.
+ */
+func sampleEach(cols []*collector.Collector, sample func([]*collector.Collector) error) []collector.Event {
+	if sample(cols) == nil {
+		return nil
+	}
+	var events []collector.Event
+	for _, c := range cols {
+		if err := sample([]*collector.Collector{c}); err != nil {
+			events = append(events, collector.Event{
+				Time:    time.Now(),
+				Domain:  c.Domain().Name,
+				UUID:    c.Domain().UUID,
+				Message: err.Error(),
+			})
+		}
+	}
+	return events
+}
+
+/* track returns a tracker of doms monitored by cols following
+ * events of b. Domains are inspected every interval if b does
+ * not deliver events.
+ */
+func track(b collector.Backend, doms []collector.Domain, cols []*collector.Collector, newf func(collector.Domain) (*collector.Collector, error)) *collector.Tracker {
+	t := collector.NewTracker(b, domainnames, doms, cols, newf)
+	if _, err := t.Subscribe(); err != nil {
+		log.Printf("%v, inspecting domains every interval instead of following events", err)
+	}
+	return t
+}
+
+// newDiskView creates a disk sampler of the view requested.
+func newDiskView(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	if backing {
+		return newLayerSampler(b, doms)
+	}
+	return newDiskSampler(b, doms)
+}
+
+type diskSampler struct {
+	tracker *collector.Tracker
+	prev    []collector.Sample
+}
+
+func newDiskSampler(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	newf := func(dom collector.Domain) (*collector.Collector, error) {
+		c, err := collector.New(b, dom, serial)
+		if err != nil {
+			return nil, err
+		}
+		if throttle {
+			if err := c.LoadIoTune(); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	}
+	cols, err := collector.NewAll(b, doms, serial)
+	if err != nil {
+		return nil, err
+	}
+	if throttle {
+		for _, c := range cols {
+			if err := c.LoadIoTune(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &diskSampler{tracker: track(b, doms, cols, newf)}, nil
+}
+
+func (s *diskSampler) sample() ([]output.Record, error) {
+	events, err := s.tracker.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	var cur []collector.Sample
+	events = append(events, sampleEach(s.tracker.Collectors(), func(cols []*collector.Collector) error {
+		samples, err := collector.SampleAll(cols)
+		cur = append(cur, samples...)
+		return err
+	})...)
+	records := diskRecords(collector.Diff(s.prev, cur))
+	s.prev = cur
+	return append(output.EventRecords(events), records...), nil
+}
+
+type layerSampler struct {
+	tracker *collector.Tracker
+	prev    []collector.LayerSample
+}
+
+func newLayerSampler(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	cols, err := collector.NewAll(b, doms, serial)
+	if err != nil {
+		return nil, err
+	}
+	return &layerSampler{tracker: track(b, doms, cols, func(dom collector.Domain) (*collector.Collector, error) {
+		return collector.New(b, dom, serial)
+	})}, nil
+}
+
+func (s *layerSampler) sample() ([]output.Record, error) {
+	events, err := s.tracker.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	var cur []collector.LayerSample
+	events = append(events, sampleEach(s.tracker.Collectors(), func(cols []*collector.Collector) error {
+		samples, err := collector.SampleAllLayers(cols)
+		cur = append(cur, samples...)
+		return err
+	})...)
+	records := output.LayerRecords(collector.DiffLayers(s.prev, cur))
+	s.prev = cur
+	return append(output.EventRecords(events), records...), nil
+}
+
+type netSampler struct {
+	tracker *collector.Tracker
+	prev    []collector.InterfaceSample
+}
+
+func newNetSampler(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	cols, err := collector.NewAllNet(b, doms, iface)
+	if err != nil {
+		return nil, err
+	}
+	return &netSampler{tracker: track(b, doms, cols, func(dom collector.Domain) (*collector.Collector, error) {
+		return collector.NewNet(b, dom, iface)
+	})}, nil
+}
+
+func (s *netSampler) sample() ([]output.Record, error) {
+	events, err := s.tracker.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	var cur []collector.InterfaceSample
+	events = append(events, sampleEach(s.tracker.Collectors(), func(cols []*collector.Collector) error {
+		samples, err := collector.SampleAllInterfaces(cols)
+		cur = append(cur, samples...)
+		return err
+	})...)
+	records := output.InterfaceRecords(collector.DiffInterfaces(s.prev, cur))
+	s.prev = cur
+	return append(output.EventRecords(events), records...), nil
+}
+
+type cpuSampler struct {
+	tracker *collector.Tracker
+	prev    []collector.CPUSample
+}
+
+func newCPUSampler(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	cols, err := collector.NewAllCPU(b, doms)
+	if err != nil {
+		return nil, err
+	}
+	return &cpuSampler{tracker: track(b, doms, cols, func(dom collector.Domain) (*collector.Collector, error) {
+		return collector.NewCPU(b, dom)
+	})}, nil
+}
+
+func (s *cpuSampler) sample() ([]output.Record, error) {
+	events, err := s.tracker.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	var cur []collector.CPUSample
+	events = append(events, sampleEach(s.tracker.Collectors(), func(cols []*collector.Collector) error {
+		samples, err := collector.SampleAllCPU(cols)
+		cur = append(cur, samples...)
+		return err
+	})...)
+	records := output.CPURecords(collector.DiffCPU(s.prev, cur))
+	s.prev = cur
+	return append(output.EventRecords(events), records...), nil
+}
+
+type memSampler struct {
+	tracker *collector.Tracker
+	prev    []collector.MemorySample
+}
+
+func newMemSampler(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	cols, err := collector.NewAllMemory(b, doms, balloonPeriod)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cols {
+		if c.MemoryStatsPeriod() == 0 {
+			log.Printf("%s: balloon statistics period is not set, guest memory stats are not reported, see --balloon-period",
+				c.Domain().Name)
+		}
+	}
+	return &memSampler{tracker: track(b, doms, cols, func(dom collector.Domain) (*collector.Collector, error) {
+		return collector.NewMemory(b, dom, balloonPeriod)
+	})}, nil
+}
+
+func (s *memSampler) sample() ([]output.Record, error) {
+	events, err := s.tracker.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	var cur []collector.MemorySample
+	events = append(events, sampleEach(s.tracker.Collectors(), func(cols []*collector.Collector) error {
+		samples, err := collector.SampleAllMemory(cols)
+		cur = append(cur, samples...)
+		return err
+	})...)
+	records := output.MemoryRecords(collector.DiffMemory(s.prev, cur))
+	s.prev = cur
+	return append(output.EventRecords(events), records...), nil
+}
+
+type capacitySampler struct {
+	tracker *collector.Tracker
+	prev    []collector.CapacitySample
+}
+
+func newCapacitySampler(b collector.Backend, doms []collector.Domain) (sampler, error) {
+	cols, err := collector.NewAll(b, doms, serial)
+	if err != nil {
+		return nil, err
+	}
+	return &capacitySampler{tracker: track(b, doms, cols, func(dom collector.Domain) (*collector.Collector, error) {
+		return collector.New(b, dom, serial)
+	})}, nil
+}
+
+func (s *capacitySampler) sample() ([]output.Record, error) {
+	events, err := s.tracker.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	var cur []collector.CapacitySample
+	events = append(events, sampleEach(s.tracker.Collectors(), func(cols []*collector.Collector) error {
+		samples, err := collector.SampleAllCapacity(cols)
+		cur = append(cur, samples...)
+		return err
+	})...)
+	records := output.CapacityRecords(collector.DiffCapacity(s.prev, cur))
+	s.prev = cur
+	return append(output.EventRecords(events), records...), nil
+}
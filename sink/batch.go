@@ -0,0 +1,169 @@
+package sink
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// permanentError is a batch rejected by the server,
+// sending it again will not help.
+type permanentError struct {
+	status  string
+	message string
+}
+
+func (e *permanentError) Error() string {
+	return e.status + ": " + e.message
+}
+
+/* batcher queues items, lines or whole requests, and sends them in
+ * batches in background, so a slow or unreachable server delays
+ * nothing. Items stay queued while the server fails, the oldest are
+ * dropped once the queue is full. Batches the server rejects are
+ * dropped. Sinks embed it and add items as they are written.
+ */
+type batcher struct {
+	// name is the server address shown in logs, a URL may hold a password
+	name string
+	// unit names items in logs, like "lines"
+	unit string
+	// send sends a batch
+	send func(batch [][]byte) error
+
+	batchSize     int
+	bufferSize    int
+	flushInterval time.Duration
+	retries       int
+	timeout       time.Duration
+
+	mu    sync.Mutex
+	items [][]byte
+	// first is sequence number of items[0]
+	first   int64
+	dropped int
+
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// start starts sending in background, once fields are set.
+func (b *batcher) start() {
+	b.kick = make(chan struct{}, 1)
+	b.done = make(chan struct{})
+	b.stopped = make(chan struct{})
+	go b.run()
+}
+
+// add queues items, a batch is sent right away once one is full.
+func (b *batcher) add(items [][]byte) {
+	b.mu.Lock()
+	b.items = append(b.items, items...)
+	if over := len(b.items) - b.bufferSize; over > 0 {
+		b.items = b.items[over:]
+		b.first += int64(over)
+		b.dropped += over
+	}
+	full := len(b.items) >= b.batchSize
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.kick:
+		case <-b.done:
+			b.flush()
+			return
+		}
+		b.flush()
+	}
+}
+
+/* flush sends queued items in batches until none are left
+ * or a batch fails, its items are kept to be sent next time.
+ * Items may be dropped by add while a batch is sent, the
+ * sequence numbers tell what is left to remove then.
+ */
+func (b *batcher) flush() {
+	for {
+		b.mu.Lock()
+		if b.dropped > 0 {
+			log.Printf("%s: buffer is full, %d %s dropped", b.name, b.dropped, b.unit)
+			b.dropped = 0
+		}
+		n := len(b.items)
+		if n > b.batchSize {
+			n = b.batchSize
+		}
+		batch := b.items[:n]
+		start := b.first
+		b.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if err := b.sendRetry(batch); err != nil {
+			log.Printf("%s: %v, %d %s kept", b.name, err, b.buffered(), b.unit)
+			return
+		}
+		b.mu.Lock()
+		if sent := start + int64(n) - b.first; sent > 0 {
+			b.items = b.items[sent:]
+			b.first += sent
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *batcher) buffered() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.items)
+}
+
+// sendRetry sends batch retrying with a growing pause. A batch the
+// server rejects is logged and considered sent.
+func (b *batcher) sendRetry(batch [][]byte) error {
+	var err error
+	pause := time.Second
+	for i := 0; i <= b.retries; i++ {
+		if i > 0 {
+			time.Sleep(pause)
+			pause *= 2
+		}
+		err = b.send(batch)
+		if e, ok := err.(*permanentError); ok {
+			log.Printf("%s: %d %s rejected: %v", b.name, len(batch), b.unit, e)
+			return nil
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Close sends items left, waiting for the server up to the timeout.
+func (b *batcher) Close() error {
+	close(b.done)
+	select {
+	case <-b.stopped:
+	case <-time.After(b.timeout):
+	}
+	if n := b.buffered(); n > 0 {
+		return fmt.Errorf("%s: %d %s not sent", b.name, n, b.unit)
+	}
+	return nil
+}
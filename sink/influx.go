@@ -0,0 +1,171 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// InfluxConfig describes writes to an InfluxDB server.
+type InfluxConfig struct {
+	// Database selects InfluxDB 1.x write API, user and password
+	// are taken from the server URL
+	Database string
+	// Org and Bucket select InfluxDB 2.x write API,
+	// Token authenticates to it
+	Org    string
+	Bucket string
+	Token  string
+	// BatchSize is the most lines sent in a request
+	BatchSize int
+	// BufferSize is the most lines kept while the server is down,
+	// the oldest ones are dropped
+	BufferSize int
+	// FlushInterval is the longest time lines wait to be sent
+	FlushInterval time.Duration
+	// Retries is the number of times a failed request is retried
+	// before lines are left buffered until the next flush
+	Retries int
+	// Timeout limits every request and the final flush on Close
+	Timeout time.Duration
+}
+
+// DefaultInfluxConfig holds sizes and durations used for zero ones
+// of InfluxConfig.
+var DefaultInfluxConfig = InfluxConfig{
+	BatchSize:     5000,
+	BufferSize:    100000,
+	FlushInterval: 10 * time.Second,
+	Retries:       3,
+	Timeout:       10 * time.Second,
+}
+
+/* Influx batches lines written to it and posts them to an InfluxDB
+ * write endpoint in background. Lines stay buffered while the server
+ * is unreachable or fails, lines it rejects as malformed are dropped.
+ */
+type Influx struct {
+	batcher
+	url    string
+	token  string
+	client *http.Client
+}
+
+// writeURL returns URL of the write endpoint of server u.
+func writeURL(u *url.URL, cfg InfluxConfig) (*url.URL, error) {
+	w := *u
+	q := w.Query()
+	base := strings.TrimSuffix(w.Path, "/")
+	switch {
+	case cfg.Bucket != "":
+		if !strings.HasSuffix(base, "/api/v2/write") {
+			w.Path = base + "/api/v2/write"
+		}
+		q.Set("bucket", cfg.Bucket)
+		if cfg.Org != "" {
+			q.Set("org", cfg.Org)
+		}
+	case cfg.Database != "":
+		if !strings.HasSuffix(base, "/write") {
+			w.Path = base + "/write"
+		}
+		q.Set("db", cfg.Database)
+	case strings.HasSuffix(base, "/write"):
+		// Complete URL is given
+	default:
+		return nil, fmt.Errorf("%s: database or bucket to write to is not set", u.Host)
+	}
+	q.Set("precision", "ns")
+	w.RawQuery = q.Encode()
+	return &w, nil
+}
+
+// NewInflux starts writing to InfluxDB server at u.
+func NewInflux(u *url.URL, cfg InfluxConfig) (*Influx, error) {
+	d := DefaultInfluxConfig
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = d.BatchSize
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = d.BufferSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = d.FlushInterval
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = d.Timeout
+	}
+	w, err := writeURL(u, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Influx{
+		url:    w.String(),
+		token:  cfg.Token,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+	s.batcher = batcher{
+		name:          w.Host,
+		unit:          "lines",
+		send:          s.send,
+		batchSize:     cfg.BatchSize,
+		bufferSize:    cfg.BufferSize,
+		flushInterval: cfg.FlushInterval,
+		retries:       cfg.Retries,
+		timeout:       cfg.Timeout,
+	}
+	s.start()
+	return s, nil
+}
+
+// Write buffers lines of p, it never blocks on the server.
+func (s *Influx) Write(p []byte) (int, error) {
+	var lines [][]byte
+	for _, l := range bytes.Split(p, []byte("\n")) {
+		if len(l) > 0 {
+			lines = append(lines, append([]byte(nil), l...))
+		}
+	}
+	s.add(lines)
+	return len(p), nil
+}
+
+func (s *Influx) send(batch [][]byte) error {
+	body := bytes.Join(batch, []byte("\n"))
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return statusError(resp, strings.TrimSpace(string(msg)))
+}
+
+// statusError returns error of a failed response with message msg,
+// a permanent one if sending the same request again will not help.
+func statusError(resp *http.Response, msg string) error {
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden:
+		return &permanentError{resp.Status, msg}
+	}
+	return fmt.Errorf("%s: %s", resp.Status, msg)
+}
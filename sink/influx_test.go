@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		cfg  InfluxConfig
+		want string
+	}{
+		{"http://influx:8086", InfluxConfig{Database: "virt"},
+			"http://influx:8086/write?db=virt&precision=ns"},
+		{"https://influx:8086/", InfluxConfig{Org: "ops", Bucket: "virt"},
+			"https://influx:8086/api/v2/write?bucket=virt&org=ops&precision=ns"},
+		{"http://influx:8086/write?db=virt&rp=week", InfluxConfig{},
+			"http://influx:8086/write?db=virt&precision=ns&rp=week"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		w, err := writeURL(u, tt.cfg)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if w.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.url, w, tt.want)
+		}
+	}
+	u, _ := url.Parse("http://influx:8086")
+	if _, err := writeURL(u, InfluxConfig{}); err == nil {
+		t.Errorf("no database nor bucket: no error")
+	}
+}
+
+// TestInfluxBuffer checks lines are kept while the server fails
+// and the oldest are dropped once the buffer is full.
+func TestInfluxBuffer(t *testing.T) {
+	var mu sync.Mutex
+	down := true
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, strings.Split(string(body), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	s, err := NewInflux(u, InfluxConfig{
+		Database:      "virt",
+		BatchSize:     2,
+		BufferSize:    3,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("m v=1i 1\nm v=2i 2\n"))
+	s.Write([]byte("m v=3i 3\nm v=4i 4\n"))
+	if n := s.buffered(); n != 3 {
+		t.Fatalf("%d lines buffered, want 3", n)
+	}
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"m v=2i 2", "m v=3i 3", "m v=4i 4"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"time"
+)
+
+// dialTimeout limits connecting and writing to stream endpoints.
+const dialTimeout = 5 * time.Second
+
+// maxDatagram keeps datagrams within a common MTU.
+const maxDatagram = 1432
+
+/* Conn writes lines to a TCP or UDP endpoint, a Carbon or StatsD
+ * server. Lines not sent by a failed write are retried once over
+ * a new connection, they are dropped and logged if it fails too.
+ * Lines are split into datagrams over UDP.
+ */
+type Conn struct {
+	network string
+	addr    string
+	conn    net.Conn
+}
+
+// NewConn returns a writer to addr over network, "tcp" or "udp".
+// Connection is made on the first write.
+func NewConn(network, addr string) *Conn {
+	return &Conn{network: network, addr: addr}
+}
+
+// packets splits p into datagrams on line boundaries.
+func packets(p []byte) [][]byte {
+	var res [][]byte
+	var cur []byte
+	for _, l := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(cur)+len(l) > maxDatagram && len(cur) > 0 {
+			res = append(res, cur)
+			cur = nil
+		}
+		cur = append(cur, l...)
+	}
+	if len(cur) > 0 {
+		res = append(res, cur)
+	}
+	return res
+}
+
+/* write sends p and returns number of bytes sent. On error it counts
+ * whole lines only, a line sent partly is cut short at the server and
+ * has to be sent again in full.
+ */
+func (c *Conn) write(p []byte) (int, error) {
+	if c.conn == nil {
+		conn, err := net.DialTimeout(c.network, c.addr, dialTimeout)
+		if err != nil {
+			return 0, err
+		}
+		c.conn = conn
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	chunks := [][]byte{p}
+	if c.network == "udp" {
+		chunks = packets(p)
+	}
+	sent := 0
+	for _, b := range chunks {
+		n, err := c.conn.Write(b)
+		if err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return sent + bytes.LastIndexByte(b[:n], '\n') + 1, err
+		}
+		sent += n
+	}
+	return sent, nil
+}
+
+// Write sends p reconnecting if needed, it only fails to drop p.
+func (c *Conn) Write(p []byte) (int, error) {
+	sent, err := c.write(p)
+	if err != nil {
+		var n int
+		n, err = c.write(p[sent:])
+		sent += n
+	}
+	if err != nil {
+		log.Printf("%s: %v, %d bytes dropped", c.addr, err, len(p)-sent)
+	}
+	return len(p), nil
+}
+
+func (c *Conn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
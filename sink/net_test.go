@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// brokenConn writes n bytes and fails.
+type brokenConn struct {
+	net.Conn
+	n int
+}
+
+func (c *brokenConn) Write(p []byte) (int, error) {
+	if len(p) > c.n {
+		return c.n, errors.New("broken pipe")
+	}
+	return len(p), nil
+}
+
+func (c *brokenConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *brokenConn) Close() error {
+	return nil
+}
+
+// TestConnPartialWrite checks lines written before a connection broke
+// are not sent again and a line cut short is sent in full.
+func TestConnPartialWrite(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		got <- string(b)
+	}()
+
+	c := NewConn("tcp", l.Addr().String())
+	// The first line and a half get through
+	c.conn = &brokenConn{n: len("a 1 1\nb 2")}
+	c.Write([]byte("a 1 1\nb 2 1\nc 3 1\n"))
+	c.Close()
+	if s := <-got; s != "b 2 1\nc 3 1\n" {
+		t.Errorf("resent %q, want the second line on", s)
+	}
+}
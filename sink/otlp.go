@@ -0,0 +1,181 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP protocols, as named by OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	OTLPHTTP = "http/protobuf"
+	OTLPGRPC = "grpc"
+)
+
+// OTLPProtocols lists supported OTLP protocols.
+var OTLPProtocols = []string{OTLPHTTP, OTLPGRPC}
+
+// otlpQueueSize is the most export requests kept while
+// the collector is down, about an hour of 10s intervals.
+const otlpQueueSize = 360
+
+// otlpRetries is the number of times a failed request is retried
+// before it is left queued until the next write or flush.
+const otlpRetries = 3
+
+// otlpFlushInterval is the longest time requests left queued wait.
+const otlpFlushInterval = 10 * time.Second
+
+// otlpGRPCMethod is the path of the gRPC metrics export method.
+const otlpGRPCMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+/* OTLP sends every write, an export request encoded as protobuf,
+ * to an OpenTelemetry collector in background, over OTLP/HTTP or
+ * OTLP/gRPC. Requests stay queued while the collector is unreachable,
+ * the oldest are dropped once the queue is full.
+ */
+type OTLP struct {
+	batcher
+	url    string
+	grpc   bool
+	client *http.Client
+}
+
+/* exportURL returns URL of the export endpoint of collector u,
+ * /v1/metrics over HTTP unless u has a path, the export method
+ * over gRPC.
+ */
+func exportURL(u *url.URL, protocol string) *url.URL {
+	m := *u
+	switch {
+	case protocol == OTLPGRPC:
+		m.Path = otlpGRPCMethod
+	case strings.TrimSuffix(m.Path, "/") == "":
+		m.Path = "/v1/metrics"
+	}
+	return &m
+}
+
+// NewOTLP starts writing to OpenTelemetry collector at u over protocol,
+// every request is limited by timeout.
+func NewOTLP(u *url.URL, protocol string, timeout time.Duration) (*OTLP, error) {
+	if timeout <= 0 {
+		timeout = DefaultInfluxConfig.Timeout
+	}
+	s := &OTLP{
+		url:    exportURL(u, protocol).String(),
+		client: &http.Client{Timeout: timeout},
+	}
+	switch protocol {
+	case OTLPHTTP:
+	case OTLPGRPC:
+		t, err := grpcTransport(u)
+		if err != nil {
+			return nil, err
+		}
+		s.grpc = true
+		s.client.Transport = t
+	default:
+		return nil, fmt.Errorf("%s: unknown OTLP protocol, use %s", protocol, strings.Join(OTLPProtocols, " or "))
+	}
+	s.batcher = batcher{
+		name:          u.Host,
+		unit:          "requests",
+		send:          s.send,
+		batchSize:     1,
+		bufferSize:    otlpQueueSize,
+		flushInterval: otlpFlushInterval,
+		retries:       otlpRetries,
+		timeout:       timeout,
+	}
+	s.start()
+	return s, nil
+}
+
+// Write queues p as a request, it never blocks on the collector.
+func (s *OTLP) Write(p []byte) (int, error) {
+	s.add([][]byte{append([]byte(nil), p...)})
+	return len(p), nil
+}
+
+func (s *OTLP) send(batch [][]byte) error {
+	if s.grpc {
+		return s.sendGRPC(batch[0])
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(batch[0]))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The body is a protobuf Status, only the status is shown
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1024))
+	return statusError(resp, "malformed export request")
+}
+
+// grpcRetryable lists gRPC status codes a request is sent again on,
+// as the OTLP specification tells.
+var grpcRetryable = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	8:  true, // RESOURCE_EXHAUSTED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+// sendGRPC calls the export method with msg, a length-prefixed
+// message, its status comes in trailers.
+func (s *OTLP) sendGRPC(msg []byte) error {
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(append(body, msg...)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Trailers are read along with the body
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// A response without a message carries status in headers
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("no gRPC status in response")
+	}
+	if code == 0 {
+		return nil
+	}
+	if m, err := url.PathUnescape(message); err == nil {
+		message = m
+	}
+	if grpcRetryable[code] {
+		return fmt.Errorf("gRPC status %d: %s", code, message)
+	}
+	return &permanentError{"gRPC status " + status, message}
+}
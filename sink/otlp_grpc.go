@@ -0,0 +1,22 @@
+//go:build go1.24
+// +build go1.24
+
+package sink
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// grpcTransport returns a transport to collector u speaking HTTP/2
+// as gRPC does, without TLS to http:// URLs.
+func grpcTransport(u *url.URL) (http.RoundTripper, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Protocols = new(http.Protocols)
+	if u.Scheme == "https" {
+		t.Protocols.SetHTTP2(true)
+	} else {
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return t, nil
+}
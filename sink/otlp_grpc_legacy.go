@@ -0,0 +1,17 @@
+//go:build !go1.24
+// +build !go1.24
+
+package sink
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+/* grpcTransport fails, HTTP/2 without TLS is spoken by net/http
+ * of Go 1.24 and later only. OTLP/HTTP works with any Go.
+ */
+func grpcTransport(u *url.URL) (http.RoundTripper, error) {
+	return nil, fmt.Errorf("OTLP over gRPC needs virtstat built with Go 1.24 or later, use %s", OTLPHTTP)
+}
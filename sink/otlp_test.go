@@ -0,0 +1,62 @@
+//go:build go1.24
+// +build go1.24
+
+package sink
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestOTLPGRPC checks requests are framed as gRPC messages over
+// HTTP/2 without TLS and a status in trailers is read.
+func TestOTLPGRPC(t *testing.T) {
+	got := make(chan []byte, 2)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.ProtoMajor != 2 || r.URL.Path != otlpGRPCMethod || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("got %s %s %s", r.Proto, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Errorf("bad message framing % x", body)
+		} else {
+			got <- body[5:]
+		}
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		if string(body[5:]) == "bad" {
+			w.Header().Set("Grpc-Status", "3")
+			w.Header().Set("Grpc-Message", "invalid%20metric")
+			return
+		}
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	s, err := NewOTLP(u, OTLPGRPC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.send([][]byte{[]byte("ok")}); err != nil {
+		t.Errorf("ok: %v", err)
+	}
+	err = s.send([][]byte{[]byte("bad")})
+	if e, ok := err.(*permanentError); !ok || e.message != "invalid metric" {
+		t.Errorf("bad: got %v, want a permanent error", err)
+	}
+	if g := string(<-got); g != "ok" {
+		t.Errorf("got message %q", g)
+	}
+	if _, err := NewOTLP(u, "http/json", 0); err == nil {
+		t.Errorf("unknown protocol: no error")
+	}
+}
@@ -0,0 +1,67 @@
+// Package sink delivers formatted statistics to files
+// and remote endpoints.
+package sink
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+)
+
+// nopCloser keeps standard output open.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+/* Open returns a writer to dest. "-" is the standard output,
+ * http:// and https:// URLs are OpenTelemetry collectors spoken
+ * to over otlpProtocol if format is "otlp", InfluxDB servers
+ * written to as described by influx otherwise, tcp://host:port and udp://host:port
+ * are Carbon or StatsD servers, zabbix://host[:port] are Zabbix
+ * trappers, anything else is a file appended to.
+ */
+func Open(dest, format, otlpProtocol string, influx InfluxConfig) (io.WriteCloser, error) {
+	if dest == "-" || dest == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	if u, err := url.Parse(dest); err == nil {
+		switch u.Scheme {
+		case "http", "https":
+			if format == "otlp" {
+				return NewOTLP(u, otlpProtocol, influx.Timeout)
+			}
+			return NewInflux(u, influx)
+		case "tcp", "udp":
+			if u.Port() == "" {
+				return nil, fmt.Errorf("%s: port is required", dest)
+			}
+			return NewConn(u.Scheme, u.Host), nil
+		case "zabbix":
+			return NewZabbix(u.Host), nil
+		}
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dest, err)
+	}
+	return f, nil
+}
+
+// Scheme returns URL scheme of a remote dest, it is empty
+// for the standard output and files.
+func Scheme(dest string) string {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "http", "https", "tcp", "udp", "zabbix":
+		return u.Scheme
+	}
+	return ""
+}
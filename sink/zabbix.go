@@ -0,0 +1,153 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ZabbixPort is the default port of Zabbix trappers.
+const ZabbixPort = "10051"
+
+// zabbixHeader starts every message of the Zabbix protocol,
+// protocol version 1.
+var zabbixHeader = []byte("ZBXD\x01")
+
+// maxZabbixResponse limits a response read.
+const maxZabbixResponse = 1 << 20
+
+// zabbixQueueSize is the most requests kept while the server
+// is down, about an hour of 10s intervals.
+const zabbixQueueSize = 360
+
+// zabbixRetries is the number of times a failed request is retried
+// before it is left queued until the next write or flush.
+const zabbixRetries = 1
+
+// zabbixFlushInterval is the longest time requests left queued wait.
+const zabbixFlushInterval = 10 * time.Second
+
+/* Zabbix sends sender requests to a Zabbix server or proxy trapper
+ * in background, a connection per request as zabbix_sender does.
+ * Requests stay queued while the server is unreachable, the oldest
+ * are dropped once the queue is full. Items the server does not
+ * accept, say of keys not configured, are logged.
+ */
+type Zabbix struct {
+	batcher
+	addr string
+}
+
+// NewZabbix starts writing to trapper at addr,
+// the default port is used if addr has none.
+func NewZabbix(addr string) *Zabbix {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), ZabbixPort)
+	}
+	s := &Zabbix{addr: addr}
+	s.batcher = batcher{
+		name:          addr,
+		unit:          "requests",
+		send:          s.send,
+		batchSize:     1,
+		bufferSize:    zabbixQueueSize,
+		flushInterval: zabbixFlushInterval,
+		retries:       zabbixRetries,
+		timeout:       2 * dialTimeout,
+	}
+	s.start()
+	return s
+}
+
+// zabbixMessage frames data as a message of the Zabbix protocol.
+func zabbixMessage(data []byte) []byte {
+	msg := make([]byte, len(zabbixHeader)+8, len(zabbixHeader)+8+len(data))
+	copy(msg, zabbixHeader)
+	binary.LittleEndian.PutUint32(msg[len(zabbixHeader):], uint32(len(data)))
+	return append(msg, data...)
+}
+
+// readZabbixMessage reads data of a message of the Zabbix protocol.
+func readZabbixMessage(r io.Reader) ([]byte, error) {
+	head := make([]byte, len(zabbixHeader)+8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head[:4], zabbixHeader[:4]) {
+		return nil, fmt.Errorf("not a Zabbix response")
+	}
+	n := binary.LittleEndian.Uint32(head[len(zabbixHeader):])
+	if n > maxZabbixResponse {
+		return nil, fmt.Errorf("response of %d bytes is too long", n)
+	}
+	data := make([]byte, n)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// zabbixResponse is a response to a sender request.
+type zabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// failed returns number of items the server did not accept
+// as told by info like "processed: 2; failed: 1; total: 3; ...".
+func (r zabbixResponse) failed() int {
+	for _, part := range strings.Split(r.Info, ";") {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "failed" {
+			n, _ := strconv.Atoi(strings.TrimSpace(kv[1]))
+			return n
+		}
+	}
+	return 0
+}
+
+// request sends data, a sender request, and reads the response.
+func (s *Zabbix) request(data []byte) (zabbixResponse, error) {
+	var resp zabbixResponse
+	conn, err := net.DialTimeout("tcp", s.addr, dialTimeout)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if _, err := conn.Write(zabbixMessage(data)); err != nil {
+		return resp, err
+	}
+	body, err := readZabbixMessage(conn)
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return resp, fmt.Errorf("bad response: %v", err)
+	}
+	return resp, nil
+}
+
+// Write queues p, a sender request, it never blocks on the server.
+func (s *Zabbix) Write(p []byte) (int, error) {
+	s.add([][]byte{append([]byte(nil), bytes.TrimSpace(p)...)})
+	return len(p), nil
+}
+
+func (s *Zabbix) send(batch [][]byte) error {
+	resp, err := s.request(batch[0])
+	switch {
+	case err != nil:
+		return err
+	case resp.Response != "success":
+		return &permanentError{"request failed", resp.Info}
+	case resp.failed() > 0:
+		log.Printf("%s: %d items not accepted, check hosts and keys: %s", s.addr, resp.failed(), resp.Info)
+	}
+	return nil
+}
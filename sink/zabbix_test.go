@@ -0,0 +1,45 @@
+package sink
+
+import (
+	"net"
+	"testing"
+)
+
+// TestZabbix checks a request reaches a trapper framed
+// and its response is read.
+func TestZabbix(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := readZabbixMessage(conn)
+		got <- string(data)
+		conn.Write(zabbixMessage([]byte(`{"response":"success","info":"processed: 1; failed: 1; total: 2; seconds spent: 0.000055"}`)))
+	}()
+	s := NewZabbix(l.Addr().String())
+	req := `{"request":"sender data","data":[]}`
+	defer s.Close()
+	resp, err := s.request([]byte(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := <-got; g != req {
+		t.Errorf("trapper got %q, want %q", g, req)
+	}
+	if resp.Response != "success" || resp.failed() != 1 {
+		t.Errorf("got response %+v, %d failed", resp, resp.failed())
+	}
+	z := NewZabbix("zabbix")
+	defer z.Close()
+	if a := z.addr; a != "zabbix:10051" {
+		t.Errorf("got address %s, want zabbix:10051", a)
+	}
+}
@@ -1,245 +1,502 @@
 package main
 
 import (
-	"encoding/xml"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/AlexZzz/virtstat/collector"
+	"github.com/AlexZzz/virtstat/exporter"
+	"github.com/AlexZzz/virtstat/libvirtbackend"
+	"github.com/AlexZzz/virtstat/output"
+	"github.com/AlexZzz/virtstat/sink"
 	"github.com/urfave/cli"
 )
 
-var domainname string
-var loops int
-var interval int64
+var domainnames []string
+var count int
+var interval time.Duration
+var connectURIs []string
+var hostsFile string
+var readOnly bool
+var authFile string
+var username string
 var serial string
+var format string
+var allDomains bool
+var iface string
+var balloonPeriod int
+var extended bool
+var throttle bool
+var backing bool
+var topN int
+var topBy string
+var outputDest string
+var template string
+var influx sink.InfluxConfig
+var zabbixHost string
+var otlpProtocol string
 
-/* Structs to be filled from xml
- * description of domain
- * XML desc: https://libvirt.org/formatdomain.html
+// connectFlags are flags of commands talking to libvirt.
+var connectFlags = []cli.Flag{
+	cli.StringSliceFlag{
+		Name:  "connect, c",
+		Usage: "libvirt connection URI, e.g. qemu:///session, qemu+ssh://host/system, may be repeated (default: \"" + defaultURI + "\")",
+	},
+	cli.StringFlag{
+		Name:        "hosts-file",
+		Usage:       "file of connection URIs or host names connected to over ssh, one per line",
+		Destination: &hostsFile,
+	},
+	cli.BoolFlag{
+		Name:        "readonly, r",
+		Usage:       "open read-only connection",
+		Destination: &readOnly,
+	},
+	cli.StringFlag{
+		Name:        "username",
+		EnvVar:      "VIRTSTAT_USERNAME",
+		Usage:       "SASL username, password is taken from " + passwordEnv + " or --auth-file",
+		Destination: &username,
+	},
+	cli.StringFlag{
+		Name:        "auth-file",
+		Usage:       "file of SASL credentials, username=... and password=... lines or a libvirt auth.conf",
+		Destination: &authFile,
+	},
+}
+
+// defaultURI is used if no connection URI is given.
+const defaultURI = "qemu:///system"
+
+// setConnectURIs collects connection URIs from --connect and --hosts-file.
+func setConnectURIs(c *cli.Context) error {
+	connectURIs = c.StringSlice("connect")
+	if hostsFile != "" {
+		uris, err := loadHosts(hostsFile)
+		if err != nil {
+			return err
+		}
+		if len(uris) == 0 {
+			return fmt.Errorf("%s: no hosts found", hostsFile)
+		}
+		connectURIs = append(connectURIs, uris...)
+	}
+	if len(connectURIs) == 0 {
+		connectURIs = []string{defaultURI}
+	}
+	return nil
+}
+
+// passwordEnv is the environment variable holding SASL password.
+const passwordEnv = "VIRTSTAT_PASSWORD"
+
+/* openBackend connects to libvirt at uri as requested by connection
+ * flags, events are delivered if events is set. Username and password
+ * from the environment override ones from --auth-file.
  */
-type disk struct {
-	XMLName xml.Name `xml:"disk"`
-	Target  struct {
-		DiskName string `xml:"dev,attr"`
-		DiskBus  string `xml:"bus,attr"`
-	} `xml:"target"`
-	Serial string `xml:"serial"`
+func openBackend(uri string, events bool) (*libvirtbackend.Backend, error) {
+	cfg := libvirtbackend.Config{
+		URI:      uri,
+		ReadOnly: readOnly,
+		Events:   events,
+	}
+	if authFile != "" {
+		// libvirt looks credentials of local connections up as localhost
+		host := "localhost"
+		if u, err := url.Parse(uri); err == nil && u.Hostname() != "" {
+			host = u.Hostname()
+		}
+		a, err := libvirtbackend.LoadAuth(authFile, host)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Auth = a
+	}
+	password := os.Getenv(passwordEnv)
+	if username != "" || password != "" {
+		if cfg.Auth == nil {
+			cfg.Auth = &libvirtbackend.Auth{}
+		}
+		if username != "" {
+			cfg.Auth.Username = username
+		}
+		if password != "" {
+			cfg.Auth.Password = password
+		}
+	}
+	return libvirtbackend.Connect(cfg)
 }
-type devices struct {
-	XMLName xml.Name `xml:"devices"`
-	Disks   []disk   `xml:"disk"`
+
+// statsFlags are flags common to every statistics command.
+var statsFlags = append([]cli.Flag{
+	cli.DurationFlag{
+		Name:        "interval, i",
+		Value:       time.Second,
+		Usage:       "interval between reports, e.g. 500ms, 5s, 1m",
+		Destination: &interval,
+	},
+	cli.IntFlag{
+		Name:        "count, n",
+		Usage:       "number of reports, 0 reports until interrupted",
+		Destination: &count,
+	},
+	cli.StringFlag{
+		Name:        "format, f",
+		Value:       "table",
+		Usage:       "output format: " + strings.Join(output.Formats, ", "),
+		Destination: &format,
+	},
+	cli.BoolFlag{
+		Name:        "all, a",
+		Usage:       "report all active domains",
+		Destination: &allDomains,
+	},
+	cli.StringFlag{
+		Name:        "output, o",
+		Value:       "-",
+		Usage:       "write to a file, to an InfluxDB server or an OpenTelemetry collector at http(s)://host:port with -f influx or otlp, to a Carbon or StatsD server at tcp:// or udp://host:port, or to a Zabbix trapper at zabbix://host[:port] with -f zabbix",
+		Destination: &outputDest,
+	},
+	cli.StringFlag{
+		Name:        "template",
+		Value:       output.DefaultTemplate,
+		Usage:       "metric path template of -f graphite and statsd, placeholders are {host}, {domain}, {uuid}, {device}, {family} and {metric}",
+		Destination: &template,
+	},
+	cli.StringFlag{
+		Name:        "otlp-protocol",
+		Value:       sink.OTLPHTTP,
+		EnvVar:      "OTEL_EXPORTER_OTLP_PROTOCOL",
+		Usage:       "protocol of -f otlp: " + strings.Join(sink.OTLPProtocols, " or "),
+		Destination: &otlpProtocol,
+	},
+	zabbixHostFlag,
+}, append(influxFlags, connectFlags...)...)
+
+var zabbixHostFlag = cli.StringFlag{
+	Name:        "zabbix-host",
+	Usage:       "Zabbix host items of a single connection are sent for, the connected host name by default",
+	Destination: &zabbixHost,
 }
-type domain struct {
-	Devices devices `xml:"devices"`
+
+// influxFlags describe writes to an InfluxDB server.
+var influxFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:        "influx-db",
+		Usage:       "InfluxDB 1.x database, user and password go to --output URL",
+		Destination: &influx.Database,
+	},
+	cli.StringFlag{
+		Name:        "influx-bucket",
+		Usage:       "InfluxDB 2.x bucket",
+		Destination: &influx.Bucket,
+	},
+	cli.StringFlag{
+		Name:        "influx-org",
+		Usage:       "InfluxDB 2.x organization",
+		Destination: &influx.Org,
+	},
+	cli.StringFlag{
+		Name:        "influx-token",
+		EnvVar:      "VIRTSTAT_INFLUX_TOKEN",
+		Usage:       "InfluxDB 2.x API token",
+		Destination: &influx.Token,
+	},
+	cli.IntFlag{
+		Name:        "batch-size",
+		Value:       sink.DefaultInfluxConfig.BatchSize,
+		Usage:       "most lines sent to InfluxDB in a request",
+		Destination: &influx.BatchSize,
+	},
+	cli.IntFlag{
+		Name:        "buffer-size",
+		Value:       sink.DefaultInfluxConfig.BufferSize,
+		Usage:       "most lines kept while InfluxDB is down, the oldest are dropped",
+		Destination: &influx.BufferSize,
+	},
+	cli.DurationFlag{
+		Name:        "flush-interval",
+		Value:       sink.DefaultInfluxConfig.FlushInterval,
+		Usage:       "longest time lines wait to be sent to InfluxDB",
+		Destination: &influx.FlushInterval,
+	},
+	cli.IntFlag{
+		Name:        "retries",
+		Value:       sink.DefaultInfluxConfig.Retries,
+		Usage:       "retries of a failed InfluxDB write before lines wait for the next flush",
+		Destination: &influx.Retries,
+	},
 }
 
-func getDisks(d *libvirt.Domain) ([]disk, error) {
-	var D domain
-	x, err := d.GetXMLDesc(libvirt.DomainXMLFlags(0))
-	xml.Unmarshal([]byte(x), &D)
-	return D.Devices.Disks, err
+var diskFlag = cli.StringFlag{
+	Name:        "disk, d",
+	Value:       "all",
+	Usage:       "disk name or serial",
+	Destination: &serial,
 }
 
-func printDisksStats(domIns *libvirt.Domain) error {
-	domDisks, err := getDisks(domIns)
-	if err != nil {
-		return err
+// validate checks options of statistics commands.
+func validate(c *cli.Context) error {
+	domainnames = c.Args()
+	if allDomains && len(domainnames) > 0 {
+		return fmt.Errorf("domains and --all are mutually exclusive")
 	}
-	type Stats struct {
-		name    string
-		dbstats libvirt.DomainBlockStats
+	if !allDomains && len(domainnames) == 0 {
+		return fmt.Errorf("domain is required, see %s %s --help", c.App.Name, c.Command.Name)
 	}
-	var disksStats []*Stats
-
-	// Filter disks by name or serial
-	for _, v := range domDisks {
-		var stats Stats
-		if serial != "all" && serial != v.Target.DiskName && serial != v.Serial {
-			continue
-		}
-		stats.name = v.Target.DiskName
-		disksStats = append(disksStats, &stats)
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive, got %v", interval)
 	}
-	if len(disksStats) == 0 {
-		return errNoSuchDisk(&serial)
+	if count < 0 {
+		return fmt.Errorf("--count must not be negative, got %d", count)
 	}
-	var actualStats Stats
-	var wrReq, rdReq, flReq int64
-	var wrTime, rdTime, flTime int64
-
-	/* Start looping pre-defined number of times
-	 * Walk through all disks. If disk is not filtered:
-	 * count, print and save statistics
-	 */
-	for c := 0; c < loops; c++ {
-		t := time.Now()
-		fmt.Printf("%d-%02d-%02d %02d:%02d:%02d",
-			t.Year(), t.Month(), t.Day(),
-			t.Hour(), t.Minute(), t.Second())
-		fmt.Printf("\n%1s%10s%12s%12s%12s%12s%12s%12s%12s%12s\n",
-			"Device:", "r/s", "w/s", "flush/s", "rkB/s", "wkB/s",
-			"r_await", "w_await", "flush_await", "err/s")
-		for _, v := range domDisks {
-			for _, s := range disksStats {
-				if s.name == v.Target.DiskName {
-					dbs, err := domIns.BlockStatsFlags(v.Target.DiskName, 4)
-					if err != nil {
-						return err
-					}
-					if c != 0 {
-						actualStats.dbstats.RdReq = dbs.RdReq - s.dbstats.RdReq
-						actualStats.dbstats.WrReq = dbs.WrReq - s.dbstats.WrReq
-						actualStats.dbstats.RdBytes = (dbs.RdBytes - s.dbstats.RdBytes) / 1024
-						actualStats.dbstats.WrBytes = (dbs.WrBytes - s.dbstats.WrBytes) / 1024
-						actualStats.dbstats.WrTotalTimes = (dbs.WrTotalTimes - s.dbstats.WrTotalTimes)
-						actualStats.dbstats.RdTotalTimes = (dbs.RdTotalTimes - s.dbstats.RdTotalTimes)
-						actualStats.dbstats.FlushReq = (dbs.FlushReq - s.dbstats.FlushReq)
-						actualStats.dbstats.FlushTotalTimes = (dbs.FlushTotalTimes - s.dbstats.FlushTotalTimes)
-						actualStats.dbstats.Errs = (dbs.Errs - s.dbstats.Errs)
-					}
-					wrReq = actualStats.dbstats.WrReq / interval
-					rdReq = actualStats.dbstats.RdReq / interval
-					flReq = actualStats.dbstats.FlushReq / interval
-					if wrReq == 0 {
-						wrTime = 0
-					} else {
-						wrTime = actualStats.dbstats.WrTotalTimes / actualStats.dbstats.WrReq
-					}
-					if rdReq == 0 {
-						rdTime = 0
-					} else {
-            rdTime = actualStats.dbstats.RdTotalTimes / actualStats.dbstats.RdReq
-					}
-					if flReq == 0 {
-						flTime = 0
-					} else {
-						flTime = actualStats.dbstats.FlushTotalTimes / actualStats.dbstats.FlushReq
-					}
-					fmt.Printf("%1s%12d%12d%12d%12d%12d%12.2f%12.2f%12.2f%12d\n", v.Target.DiskName,
-						rdReq,
-						wrReq,
-						flReq,
-						actualStats.dbstats.RdBytes/interval,
-						actualStats.dbstats.WrBytes/interval,
-						float64(rdTime/1000)/1000,
-						float64(wrTime/1000)/1000,
-						float64(flTime/1000)/1000,
-						actualStats.dbstats.Errs/interval)
-					s.dbstats.RdReq = dbs.RdReq
-					s.dbstats.WrReq = dbs.WrReq
-					s.dbstats.RdBytes = dbs.RdBytes
-					s.dbstats.WrBytes = dbs.WrBytes
-					s.dbstats.WrTotalTimes = dbs.WrTotalTimes
-					s.dbstats.RdTotalTimes = dbs.RdTotalTimes
-					s.dbstats.FlushReq = dbs.FlushReq
-					s.dbstats.FlushTotalTimes = dbs.FlushTotalTimes
-					s.dbstats.Errs = dbs.Errs
-					break
-				}
-			}
+	if extended && throttle || extended && backing || throttle && backing {
+		return fmt.Errorf("--extended, --throttle and --backing are mutually exclusive")
+	}
+	if readOnly && balloonPeriod > 0 {
+		return fmt.Errorf("--balloon-period can not be set over --readonly connection")
+	}
+	if topN < 0 {
+		return fmt.Errorf("--top must not be negative, got %d", topN)
+	}
+	switch sink.Scheme(outputDest) {
+	case "http", "https":
+		if format != "influx" && format != "otlp" {
+			return fmt.Errorf("--output %s needs -f influx or -f otlp", outputDest)
+		}
+	case "tcp":
+		if format != "graphite" {
+			return fmt.Errorf("--output %s needs -f graphite", outputDest)
+		}
+	case "udp":
+		if format != "graphite" && format != "statsd" {
+			return fmt.Errorf("--output %s needs -f graphite or -f statsd", outputDest)
+		}
+	case "zabbix":
+		if format != "zabbix" {
+			return fmt.Errorf("--output %s needs -f zabbix", outputDest)
+		}
+	default:
+		if format == "otlp" {
+			return fmt.Errorf("-f otlp needs --output http://collector:4318")
 		}
-		fmt.Printf("\n")
-		time.Sleep(time.Duration(interval) * time.Second)
 	}
-	return nil
+	return setConnectURIs(c)
 }
 
-type errMessage struct {
-	message string
+// statsAction returns an action reporting statistics
+// sampled by a sampler made with newSampler.
+func statsAction(newSampler samplerFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		err := validate(c)
+		if err != nil {
+			return err
+		}
+		w, err := sink.Open(outputDest, format, otlpProtocol, influx)
+		if err != nil {
+			return err
+		}
+		out, err := newFormatter(w, columns(c.Command.Name))
+		if err != nil {
+			w.Close()
+			return err
+		}
+		err = connectAndPrint(newSampler, out)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
 }
 
-func errNoSuchDomain(dom *string) *errMessage {
-	return &errMessage{
-		message: (*dom + ": no such domain"),
+/* newFormatter returns a formatter of the requested format writing
+ * to w, columns are the fields delimiter separated values hold.
+ */
+func newFormatter(w io.Writer, columns []string) (output.Formatter, error) {
+	switch {
+	case format == "csv":
+		return output.NewCSV(w, ',', columns, len(connectURIs) > 1), nil
+	case format == "tsv":
+		return output.NewCSV(w, '\t', columns, len(connectURIs) > 1), nil
+	case format == "graphite" || format == "statsd":
+		return output.NewGraphite(w, template, format == "statsd")
+	case format == "otlp":
+		return output.NewOTLP(w, otlpResource), nil
+	case format == "zabbix":
+		return output.NewZabbix(w, localZabbixHost()), nil
+	case topN > 0:
+		return output.NewTop(format, w)
 	}
+	return output.New(format, w)
 }
 
-func errNoSuchDisk(serial *string) *errMessage {
-	if *serial != "all" {
-		return &errMessage{
-			message: (*serial + ": no such disk"),
+/* otlpResource returns OTLP resource attributes of records of host,
+ * the host name and the libvirt driver, like qemu. host is empty if
+ * a single hypervisor is monitored.
+ */
+func otlpResource(host string) []output.Field {
+	uri := connectURIs[0]
+	for _, u := range connectURIs {
+		if hostName(u) == host {
+			uri = u
+			break
 		}
 	}
-	return &errMessage{
-		message: ("no disks found"),
+	name := hostName(uri)
+	if name == uri {
+		// Local connection
+		name, _ = os.Hostname()
+	}
+	driver := uri
+	if i := strings.IndexAny(uri, "+:"); i >= 0 {
+		driver = uri[:i]
+	}
+	return []output.Field{
+		{Name: "service.name", Value: "virtstat"},
+		{Name: "host.name", Value: name},
+		{Name: "virt.hypervisor", Value: driver},
 	}
 }
 
-func (e *errMessage) Error() string {
-	return e.message
+// localZabbixHost returns Zabbix host of a single connection.
+func localZabbixHost() string {
+	if zabbixHost != "" {
+		return zabbixHost
+	}
+	if name := hostName(connectURIs[0]); name != connectURIs[0] {
+		return name
+	}
+	name, _ := os.Hostname()
+	return name
 }
 
-func connectAndPrint(c *cli.Context) error {
-
-	domainname = c.Args().Get(0)
+/* connectAndPrint samples all filtered devices of every domain
+ * of every host pre-defined number of times and prints statistics,
+ * or a summary of the busiest devices if --top is set.
+ */
+func connectAndPrint(newSampler samplerFunc, out output.Formatter) error {
+	reports := make(chan report)
+	errc := watchAll(newSampler, reports)
 	var err error
-	if c.NArg() > 1 {
-		interval, err = strconv.ParseInt(c.Args().Get(1), 10, 64)
-		if err != nil {
-			return err
-		}
+	if topN > 0 {
+		err = printTop(reports, out)
+	} else {
+		err = printReports(reports, out)
 	}
-	if interval == 0 {
-		interval = 1
+	if err != nil {
+		return err
 	}
+	return <-errc
+}
 
-	if c.NArg() > 2 {
-		loops, err = strconv.Atoi(c.Args().Get(2))
-		if err != nil {
-			return err
-		}
+func runExporter(c *cli.Context) error {
+	if c.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(c.Args(), " "))
 	}
-	if loops == 0 {
-		loops = 999999
+	if err := setConnectURIs(c); err != nil {
+		return err
 	}
-
-	conn, err := libvirt.NewConnect("qemu:///system")
+	if len(connectURIs) > 1 {
+		return fmt.Errorf("exporter serves a single connection, run one per host")
+	}
+	backend, err := openBackend(connectURIs[0], false)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
-	doms, err := conn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	defer backend.Close()
+	return exporter.ListenAndServe(c.String("listen"), backend)
+}
+
+// listHost describes domains matching patterns at uri.
+func listHost(uri string, patterns []string) ([]collector.DomainInventory, error) {
+	backend, err := openBackend(uri, false)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer backend.Close()
+	doms, err := collector.MatchAllDomains(backend, patterns)
+	if err != nil {
+		return nil, err
 	}
-	var domIns *libvirt.Domain
-	for _, dom := range doms {
-		name, err := dom.GetName()
+	return collector.Inventory(backend, doms)
+}
+
+// inventory describes domains matching patterns of every host.
+func inventory(patterns []string) ([]output.Inventory, error) {
+	var inv []output.Inventory
+	for _, uri := range connectURIs {
+		doms, err := listHost(uri, patterns)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if strings.Compare(name, domainname) == 0 {
-			domIns = &dom
-			break
+		var host string
+		if len(connectURIs) > 1 {
+			host = hostName(uri)
 		}
-		name, err = dom.GetUUIDString()
-		if err != nil {
-			return err
+		for _, d := range doms {
+			inv = append(inv, output.Inventory{Host: host, DomainInventory: d})
 		}
-		if strings.Compare(name, domainname) == 0 {
-			domIns = &dom
-			break
-		}
-		dom.Free()
 	}
-	if domIns == nil {
-		return errNoSuchDomain(&domainname)
+	return inv, nil
+}
+
+func runList(c *cli.Context) error {
+	if err := setConnectURIs(c); err != nil {
+		return err
 	}
-	err = printDisksStats(domIns)
+	inv, err := inventory(c.Args())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	return nil
+	return output.WriteInventory(os.Stdout, format, inv)
+}
+
+/* runZabbixDiscover prints Zabbix low-level discovery of domains,
+ * disks or interfaces, or sends it to a trapper if --output is
+ * a zabbix:// URL.
+ */
+func runZabbixDiscover(c *cli.Context) error {
+	known := false
+	for _, k := range output.DiscoveryKinds {
+		known = known || k == c.Args().First()
+	}
+	if !known {
+		return fmt.Errorf("discovery of %s is required", strings.Join(output.DiscoveryKinds, ", "))
+	}
+	if err := setConnectURIs(c); err != nil {
+		return err
+	}
+	inv, err := inventory(c.Args().Tail())
+	if err != nil {
+		return err
+	}
+	scheme := sink.Scheme(outputDest)
+	if scheme != "" && scheme != "zabbix" {
+		return fmt.Errorf("--output %s: use a file or a zabbix:// URL", outputDest)
+	}
+	w, err := sink.Open(outputDest, "zabbix", "", influx)
+	if err != nil {
+		return err
+	}
+	kind := c.Args().First()
+	if scheme == "zabbix" {
+		err = output.WriteDiscoverySender(w, kind, inv, localZabbixHost())
+	} else {
+		err = output.WriteDiscovery(w, kind, inv)
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 func main() {
 	app := cli.NewApp()
-	app.Action = connectAndPrint
 	app.Name = "virtstat"
 	app.Usage = "report statistics for libvirt domains"
 	app.Authors = []cli.Author{
@@ -248,49 +505,182 @@ func main() {
 			Email: "zakharov.a.g@yandex.ru",
 		},
 	}
+	app.EnableBashCompletion = true
 	app.Commands = []cli.Command{
 		{
-			Name:  "domain",
-			Usage: "uuid or name of domain (required)",
+			Name:         "disk",
+			Usage:        "report block devices statistics",
+			ArgsUsage:    "<domain>...",
+			Action:       statsAction(newDiskView),
+			BashComplete: completeDomains,
+			Flags: append([]cli.Flag{
+				diskFlag,
+				cli.BoolFlag{
+					Name:        "extended, x",
+					Usage:       "report iostat -x like extended statistics",
+					Destination: &extended,
+				},
+				cli.BoolFlag{
+					Name:        "throttle, t",
+					Usage:       "report utilization of disks I/O limits",
+					Destination: &throttle,
+				},
+				cli.BoolFlag{
+					Name:        "backing, b",
+					Usage:       "report every image of disks backing chains",
+					Destination: &backing,
+				},
+				cli.IntFlag{
+					Name:        "top",
+					Usage:       "report only N busiest disks across all hosts",
+					Destination: &topN,
+				},
+				cli.StringFlag{
+					Name:        "top-by",
+					Value:       "r/s+w/s",
+					Usage:       "columns to rank disks by with --top, summed if joined with +",
+					Destination: &topBy,
+				},
+			}, statsFlags...),
 		},
 		{
-			Name:  "interval",
-			Usage: "interval to print stats, seconds (default 1)",
+			Name:         "net",
+			Usage:        "report network interfaces statistics",
+			ArgsUsage:    "<domain>...",
+			Action:       statsAction(newNetSampler),
+			BashComplete: completeDomains,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "iface, I",
+					Value:       "all",
+					Usage:       "network interface name or MAC address",
+					Destination: &iface,
+				},
+			}, statsFlags...),
 		},
 		{
-			Name:  "count",
-			Usage: "print stats count times (default 999999)",
+			Name:         "cpu",
+			Usage:        "report domains and vcpus cpu usage",
+			ArgsUsage:    "<domain>...",
+			Action:       statsAction(newCPUSampler),
+			BashComplete: completeDomains,
+			Flags:        statsFlags,
 		},
-	}
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:        "disk, d",
-			Value:       "all",
-			Usage:       "disk name or serial",
-			Destination: &serial,
+		{
+			Name:         "mem",
+			Usage:        "report memory and balloon statistics",
+			ArgsUsage:    "<domain>...",
+			Action:       statsAction(newMemSampler),
+			BashComplete: completeDomains,
+			Flags: append([]cli.Flag{
+				cli.IntFlag{
+					Name:        "balloon-period",
+					Usage:       "set balloon statistics period of domains which have none, seconds",
+					Destination: &balloonPeriod,
+				},
+			}, statsFlags...),
+		},
+		{
+			Name:         "df",
+			Usage:        "report disks capacity, allocation and its growth",
+			ArgsUsage:    "<domain>...",
+			Action:       statsAction(newCapacitySampler),
+			BashComplete: completeDomains,
+			Flags:        append([]cli.Flag{diskFlag}, statsFlags...),
+		},
+		{
+			Name:         "check",
+			Usage:        "check disks of a domain against thresholds as a Nagios or Icinga plugin",
+			ArgsUsage:    "<domain>",
+			Action:       runCheck,
+			OnUsageError: checkUsageError,
+			BashComplete: completeDomains,
+			Flags: append([]cli.Flag{
+				diskFlag,
+				cli.BoolFlag{
+					Name:        "extended, x",
+					Usage:       "check iostat -x like extended statistics",
+					Destination: &extended,
+				},
+				cli.StringSliceFlag{
+					Name:  "warn, w",
+					Usage: "warning threshold like 'err/s>0', may be repeated",
+				},
+				cli.StringSliceFlag{
+					Name:  "crit",
+					Usage: "critical threshold like 'w_await>50ms', may be repeated",
+				},
+				cli.DurationFlag{
+					Name:        "interval, i",
+					Value:       time.Second,
+					Usage:       "interval to sample over",
+					Destination: &interval,
+				},
+				cli.IntFlag{
+					Name:        "count, n",
+					Value:       5,
+					Usage:       "number of intervals rates are computed over",
+					Destination: &count,
+				},
+			}, connectFlags...),
+		},
+		{
+			Name:         "list",
+			Usage:        "list domains and their disks and interfaces",
+			ArgsUsage:    "[domain]...",
+			Action:       runList,
+			BashComplete: completeDomains,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "format, f",
+					Value:       "table",
+					Usage:       "output format: " + strings.Join(output.InventoryFormats, ", "),
+					Destination: &format,
+				},
+			}, connectFlags...),
+		},
+		{
+			Name:  "zabbix",
+			Usage: "integrate with Zabbix",
+			Subcommands: []cli.Command{
+				{
+					Name:         "discover",
+					Usage:        "print or send low-level discovery of domains, disks or interfaces",
+					ArgsUsage:    strings.Join(output.DiscoveryKinds, "|") + " [domain]...",
+					Action:       runZabbixDiscover,
+					BashComplete: completeDomains,
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:        "output, o",
+							Value:       "-",
+							Usage:       "write to a file or send to a Zabbix trapper at zabbix://host[:port]",
+							Destination: &outputDest,
+						},
+						zabbixHostFlag,
+					}, connectFlags...),
+				},
+			},
+		},
+		{
+			Name:   "exporter",
+			Usage:  "serve Prometheus metrics of all active domains over HTTP",
+			Action: runExporter,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "listen, l",
+					Value: ":9177",
+					Usage: "address to listen on, metrics are served at /metrics",
+				},
+			}, connectFlags...),
+		},
+		{
+			Name:      "completion",
+			Usage:     "print shell completion script",
+			ArgsUsage: strings.Join(shells, "|"),
+			Action:    printCompletion,
 		},
 	}
 	app.Version = "1.4"
-	cli.AppHelpTemplate = `NAME:
-   {{.Name}} - {{.Usage}}
-USAGE:
-   {{.HelpName}}{{if .Commands}} [global options] {{end}}{{if .VisibleFlags}}<domain> {{end}}{{if .ArgsUsage}}{{.ArgsUsage}}{{else}}[interval] [count]{{end}}
-   {{if len .Authors}}
-AUTHOR:
-   {{range .Authors}}{{ . }}{{end}}
-   {{end}}{{if .Commands}}
-COMMANDS:
-{{range .Commands}}{{if not .HideHelp}}   {{join .Names ", "}}{{ "\t"}}{{.Usage}}{{ "\n" }}{{end}}{{end}}{{end}}{{if .VisibleFlags}}
-GLOBAL OPTIONS:
-   {{range .VisibleFlags}}{{.}}
-   {{end}}{{end}}{{if .Copyright }}
-COPYRIGHT:
-   {{.Copyright}}
-   {{end}}{{if .Version}}
-VERSION:
-   {{.Version}}
-   {{end}}
-`
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Fatal(err)